@@ -1,72 +1,174 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"time"
 	"xelis-mining-proxy/log"
+	"xelis-mining-proxy/proxy"
+	"xelis-mining-proxy/util"
 )
 
-var PoolProtocol string = "xatum"
+// Path of the configuration file, set at startup by findCfgPath. It may not exist: the defaults are then used,
+// and it is where the configuration is saved.
+var cfgPath = CONFIG_NAMES[0]
 
-type Config struct {
-	WalletAddress   string `json:"wallet"`
-	PoolUrl         string `json:"pool_url"`
-	PoolProtocol    string `json:"pool_protocol"`
-	GetworkBindPort uint16 `json:"getwork_bind_port"`
-	StratumBindPort uint16 `json:"stratum_bind_port"`
-	Debug           bool   `json:"debug"`
+// returns the directories searched for the configuration file, in order: the working directory, the directory of
+// the executable, then $XDG_CONFIG_HOME/xelis-mining-proxy, then /etc/xelis-mining-proxy
+func cfgSearchDirs() []string {
+	var dirs []string
+
+	if wd, err := os.Getwd(); err == nil {
+		dirs = append(dirs, wd)
+	}
+	if ex, err := os.Executable(); err == nil {
+		if ex, err = filepath.EvalSymlinks(ex); err == nil && !slices.Contains(dirs, filepath.Dir(ex)) {
+			dirs = append(dirs, filepath.Dir(ex))
+		}
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(dir, "xelis-mining-proxy"))
+	}
+	if runtime.GOOS != "windows" {
+		dirs = append(dirs, "/etc/xelis-mining-proxy")
+	}
+	return dirs
 }
 
-// 5210: Getwork
+// returns the path of the configuration file: the path given with --config, or the first of CONFIG_NAMES found in
+// the search paths. If there is none, it returns the path of config.json in the user configuration directory.
+func findCfgPath(flagPath string) string {
+	if flagPath != "" {
+		return flagPath
+	}
 
-var Cfg = Config{
-	Debug:           false,
-	WalletAddress:   "YOUR_WALLET_ADDRESS",
-	PoolUrl:         "127.0.0.1:8080",
-	PoolProtocol:    "auto",
-	StratumBindPort: 5209,
-	GetworkBindPort: 5210,
-}
+	dirs := cfgSearchDirs()
+	for _, dir := range dirs {
+		for _, name := range CONFIG_NAMES {
+			p := filepath.Join(dir, name)
+			if _, err := os.Stat(p); err == nil {
+				return p
+			}
+		}
+	}
 
-func init() {
-	loadCfg()
+	if dir, err := os.UserConfigDir(); err == nil {
+		return filepath.Join(dir, "xelis-mining-proxy", CONFIG_NAMES[0])
+	}
+	return filepath.Join(dirs[0], CONFIG_NAMES[0])
 }
 
-func loadCfg() {
-	data, err := os.ReadFile(path() + "/config.json")
-
+// reads the configuration file over c
+func loadCfg(c *proxy.Config) error {
+	data, err := os.ReadFile(cfgPath)
 	if err != nil {
-		log.Warn("failed to open configuration:", err)
-		saveCfg()
-		return
+		return err
 	}
 
-	err = json.Unmarshal(data, &Cfg)
+	return decodeCfg(data, cfgFormat(cfgPath), c)
+}
 
+// writes a configuration to the configuration file. The file may contain secrets, so it is only readable by its
+// owner.
+func saveCfg(c proxy.Config) error {
+	data, err := encodeCfg(c, cfgFormat(cfgPath))
 	if err != nil {
-		log.Warn("failed to decode configuration:", err)
-		return
+		return err
 	}
-}
 
-func saveCfg() {
-	data, err := json.MarshalIndent(Cfg, "", "\t")
+	err = os.MkdirAll(path(), 0o750)
+	if err == nil {
+		err = util.WriteFileAtomic(cfgPath, data, 0o600)
+	}
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	log.Info("Saved configuration to", cfgPath)
+	return nil
+}
 
-	err = os.WriteFile(path()+"/config.json", data, 0o666)
-	if err != nil {
-		log.Err(err)
+// saves the wallet address to the configuration file, with the other values of the file. The values set by the
+// environment variables and the flags aren't saved.
+func saveWallet(wallet string) error {
+	c := proxy.DefaultConfig()
+	if err := loadCfg(&c); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
 	}
+	c.WalletAddress = wallet
+	return saveCfg(c)
 }
 
+// returns the directory of the configuration file, where the other state files of the proxy are saved
 func path() string {
-	return "."
-	/*ex, err := os.Executable()
+	return filepath.Dir(cfgPath)
+}
+
+// applies the logging configuration
+func configureLogging(cfg proxy.Config) error {
+	level := cfg.LogLevel
+	if cfg.Debug && level != "trace" {
+		level = "debug"
+	}
+	if level != "" {
+		l, err := log.ParseLevel(level)
+		if err != nil {
+			return err
+		}
+		log.SetLevel(l)
+	}
+
+	log.ResetComponentLevels()
+	for component, level := range cfg.LogLevels {
+		l, err := log.ParseLevel(level)
+		if err != nil {
+			return fmt.Errorf("log level of %s: %w", component, err)
+		}
+		log.SetComponentLevel(component, l)
+	}
+
+	switch cfg.LogFormat {
+	case "", "text":
+		log.SetJSON(false)
+	case "json":
+		log.SetJSON(true)
+	default:
+		return fmt.Errorf("unknown log format %q", cfg.LogFormat)
+	}
+
+	if cfg.LogFile == "" {
+		log.SetFile(nil)
+		return nil
+	}
+
+	f, err := log.OpenRotatingFile(cfg.LogFile, int64(cfg.LogMaxSize)*1024*1024,
+		time.Duration(cfg.LogRotateInterval)*time.Hour, int(cfg.LogMaxFiles),
+		time.Duration(cfg.LogMaxAge)*24*time.Hour)
+	if err != nil {
+		return err
+	}
+	log.SetFile(f)
+	return nil
+}
+
+// check-config subcommand: validates the configuration, and prints the errors
+func checkConfigCommand(c proxy.Config, loadErr error) int {
+	if loadErr != nil {
+		fmt.Fprintln(os.Stderr, "invalid configuration:", loadErr)
+		return 1
+	}
+
+	c.Normalize()
+	err := c.Validate()
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, "invalid configuration:")
+		fmt.Fprintln(os.Stderr, err)
+		return 1
 	}
-	exPath := filepath.Dir(ex)
-	return strings.TrimSuffix(exPath, string(os.PathSeparator))*/
+	fmt.Println("configuration is valid")
+	return 0
 }
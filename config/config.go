@@ -2,3 +2,6 @@ package config
 
 const TIMEOUT = 10
 const SLAVE_MINER_TIMEOUT = 30
+
+// time (in seconds) during which a disconnected miner keeps its extra nonce
+const EXTRANONCE_REUSE_TIMEOUT = 300
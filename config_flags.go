@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"xelis-mining-proxy/proxy"
+)
+
+// Command-line flags and environment variables of the config fields
+//
+// Every field of Config can be set with a flag and an environment variable named after its JSON name: pool_url
+// is --pool-url and XMP_POOL_URL. The fields of nested structs are prefixed with the name of the struct. Values
+// override config.json in this order: defaults < config.json < environment < flags.
+
+const ENV_PREFIX = "XMP_"
+
+// older names of the flags
+var flagAliases = map[string]string{
+	"pool-url":      "url",
+	"pool-protocol": "protocol",
+}
+
+// a config field that can be overridden
+type cfgField struct {
+	name  string // JSON name, with the names of the parent structs: "parent.field"
+	index []int  // reflect index in Config
+	kind  reflect.Type
+	desc  string
+}
+
+func (f cfgField) flagName() string {
+	return strings.NewReplacer("_", "-", ".", "-").Replace(f.name)
+}
+
+func (f cfgField) envName() string {
+	return ENV_PREFIX + strings.ToUpper(strings.NewReplacer(".", "_").Replace(f.name))
+}
+
+// lists the fields of a struct type, recursing into the nested structs
+func listCfgFields(t reflect.Type, prefix string, index []int) []cfgField {
+	var fields []cfgField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := proxy.FieldName(sf)
+		if name == "-" {
+			continue
+		}
+		name = prefix + name
+		idx := append(append([]int{}, index...), i)
+
+		if sf.Type.Kind() == reflect.Struct {
+			fields = append(fields, listCfgFields(sf.Type, name+".", idx)...)
+			continue
+		}
+		fields = append(fields, cfgField{name, idx, sf.Type, sf.Tag.Get("desc")})
+	}
+	return fields
+}
+
+var cfgFields = listCfgFields(reflect.TypeOf(proxy.Config{}), "", nil)
+
+// parses a flag or environment value into v. Lists are separated by commas, maps are key=value lists, and other
+// types are JSON.
+func setCfgValue(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String || strings.HasPrefix(s, "[") {
+			return json.Unmarshal([]byte(s), v.Addr().Interface())
+		}
+		list := []string{}
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list).Convert(v.Type()))
+	case reflect.Map:
+		if strings.HasPrefix(s, "{") {
+			return json.Unmarshal([]byte(s), v.Addr().Interface())
+		}
+		m := reflect.MakeMap(v.Type())
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			key, value, ok := strings.Cut(item, "=")
+			if !ok {
+				return fmt.Errorf("expected key=value, got %q", item)
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := setCfgValue(elem, strings.TrimSpace(value)); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			m.SetMapIndex(reflect.ValueOf(strings.TrimSpace(key)).Convert(v.Type().Key()), elem)
+		}
+		v.Set(m)
+	default:
+		return json.Unmarshal([]byte(s), v.Addr().Interface())
+	}
+	return nil
+}
+
+// flag.Value of a config field, storing the raw value until it is applied
+type cfgFlag struct {
+	field cfgField
+	value *string
+}
+
+func (f cfgFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return *f.value
+}
+
+func (f cfgFlag) Set(s string) error {
+	// check the value now, so an invalid flag is reported by flag.Parse
+	err := setCfgValue(reflect.New(f.field.kind).Elem(), s)
+	if err != nil {
+		return err
+	}
+	*f.value = s
+	return nil
+}
+
+func (f cfgFlag) IsBoolFlag() bool {
+	return f.field.kind.Kind() == reflect.Bool
+}
+
+// registers a flag for every config field
+func registerCfgFlags(fs *flag.FlagSet) {
+	for _, f := range cfgFields {
+		usage := fmt.Sprintf("%s (%s, environment variable %s)", f.desc, f.name, f.envName())
+
+		value := new(string)
+		fs.Var(cfgFlag{f, value}, f.flagName(), usage)
+		if alias, ok := flagAliases[f.flagName()]; ok {
+			fs.Var(cfgFlag{f, value}, alias, "same as --"+f.flagName())
+		}
+	}
+}
+
+// applies the XMP_* environment variables, then the flags set on the command line
+func applyCfgOverrides(c *proxy.Config) error {
+	return applyOverrides(flag.CommandLine, c)
+}
+
+// applies the XMP_* environment variables, then the flags set in fs, registered by registerCfgFlags
+func applyOverrides(fs *flag.FlagSet, c *proxy.Config) error {
+	v := reflect.ValueOf(c).Elem()
+
+	for _, f := range cfgFields {
+		if s, ok := os.LookupEnv(f.envName()); ok {
+			err := setCfgValue(v.FieldByIndex(f.index), s)
+			if err != nil {
+				return fmt.Errorf("%s: %w", f.envName(), err)
+			}
+		}
+	}
+
+	fs.Visit(func(fl *flag.Flag) {
+		if cf, ok := fl.Value.(cfgFlag); ok {
+			// values were checked by Set
+			setCfgValue(v.FieldByIndex(cf.field.index), *cf.value)
+		}
+	})
+	return nil
+}
+
+// prints the configuration resulting from the defaults, config.json, the environment and the flags
+func printConfig(c proxy.Config) {
+	data, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(string(data))
+}
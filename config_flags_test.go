@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"xelis-mining-proxy/proxy"
+)
+
+// returns a flag set with the config flags, parsed from args
+func parseCfgFlags(args ...string) (*flag.FlagSet, error) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	registerCfgFlags(fs)
+	return fs, fs.Parse(args)
+}
+
+func TestCfgOverridePrecedence(t *testing.T) {
+	c := proxy.DefaultConfig()
+	file := `{"pool_url": "file:8080", "stratum_bind_port": 1000, "hashrate_log_interval": 1, "share_rate": 5}`
+	if err := decodeCfg([]byte(file), "json", &c); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("XMP_POOL_URL", "env:8080")
+	t.Setenv("XMP_STRATUM_BIND_PORT", "2000")
+	t.Setenv("XMP_SHARE_RATE", "7.5")
+	fs, err := parseCfgFlags("--pool-url", "flag:8080", "--share-rate=9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := applyOverrides(fs, &c); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		got      any
+		expected any
+	}{
+		{"pool_url (file, env and flag)", c.PoolUrl, "flag:8080"},
+		{"share_rate (file, env and flag)", c.ShareRate, 9.0},
+		{"stratum_bind_port (file and env)", c.StratumBindPort, uint16(2000)},
+		{"hashrate_log_interval (file)", c.HashrateLogInterval, uint64(1)},
+		{"getwork_bind_port (default)", c.GetworkBindPort, proxy.DefaultConfig().GetworkBindPort},
+	}
+	for _, test := range tests {
+		if test.got != test.expected {
+			t.Errorf("%s = %v; want %v", test.name, test.got, test.expected)
+		}
+	}
+}
+
+func TestCfgFlagAliases(t *testing.T) {
+	tests := []struct {
+		args     []string
+		url      string
+		protocol string
+	}{
+		{[]string{"--url", "pool:8080", "--protocol", "getwork"}, "pool:8080", "getwork"},
+		{[]string{"--pool-url", "pool:8080", "--pool-protocol", "getwork"}, "pool:8080", "getwork"},
+		// the alias and the flag set the same field, the last one wins
+		{[]string{"--url", "old:8080", "--pool-url", "new:8080"}, "new:8080", "auto"},
+		{[]string{"--pool-url", "new:8080", "--url", "old:8080"}, "old:8080", "auto"},
+	}
+
+	for _, test := range tests {
+		fs, err := parseCfgFlags(test.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := proxy.DefaultConfig()
+		if err := applyOverrides(fs, &c); err != nil {
+			t.Fatal(err)
+		}
+		if c.PoolUrl != test.url || c.PoolProtocol != test.protocol {
+			t.Errorf("%v: pool_url %q, pool_protocol %q; want %q, %q", test.args, c.PoolUrl, c.PoolProtocol,
+				test.url, test.protocol)
+		}
+	}
+}
+
+func TestCfgOverrideValues(t *testing.T) {
+	fs, err := parseCfgFlags("--debug", "--allowed-ips", "10.0.0.0/8, ::1", "--log-levels", "stratum=debug,api=warn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XMP_DENIED_IPS", `["10.0.0.5"]`)
+
+	c := proxy.DefaultConfig()
+	if err := applyOverrides(fs, &c); err != nil {
+		t.Fatal(err)
+	}
+
+	if !c.Debug {
+		t.Error("--debug not applied")
+	}
+	if !reflect.DeepEqual(c.AllowedIPs, []string{"10.0.0.0/8", "::1"}) {
+		t.Errorf("allowed_ips = %q", c.AllowedIPs)
+	}
+	if !reflect.DeepEqual(c.DeniedIPs, []string{"10.0.0.5"}) {
+		t.Errorf("denied_ips = %q", c.DeniedIPs)
+	}
+	if !reflect.DeepEqual(c.LogLevels, map[string]string{"stratum": "debug", "api": "warn"}) {
+		t.Errorf("log_levels = %v", c.LogLevels)
+	}
+}
+
+func TestCfgOverrideErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"--stratum-bind-port", "70000"},
+		{"--debug=maybe"},
+		{"--log-levels", "stratum"},
+		{"--unknown-field", "1"},
+	} {
+		if _, err := parseCfgFlags(args...); err == nil {
+			t.Errorf("%v accepted; want an error", args)
+		}
+	}
+
+	fs, err := parseCfgFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XMP_GETWORK_BIND_PORT", "port")
+	c := proxy.DefaultConfig()
+	if err := applyOverrides(fs, &c); err == nil || !strings.HasPrefix(err.Error(), "XMP_GETWORK_BIND_PORT: ") {
+		t.Errorf("invalid environment variable returned %v; want an error of XMP_GETWORK_BIND_PORT", err)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"xelis-mining-proxy/proxy"
+	"xelis-mining-proxy/util"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Configuration file formats: JSON, YAML and TOML, selected by the extension of the file. Every format uses the
+// JSON names of the fields.
+
+// names of the configuration file in the search paths, in order of preference
+var CONFIG_NAMES = []string{"config.json", "config.yaml", "config.yml", "config.toml"}
+
+// maximum length of the lines of the comments in YAML and TOML configurations
+const CONFIG_COMMENT_WIDTH = 100
+
+// returns the format of a configuration file from its extension: json, yaml or toml
+func cfgFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	default:
+		return "json"
+	}
+}
+
+// decodes a configuration file of the given format over c, rejecting the unknown keys
+func decodeCfg(data []byte, format string, c *proxy.Config) error {
+	var raw map[string]any
+	var err error
+
+	switch format {
+	case "yaml":
+		err = yaml.Unmarshal(data, &raw)
+	case "toml":
+		_, err = toml.Decode(string(data), &raw)
+	default:
+		d := json.NewDecoder(bytes.NewReader(data))
+		d.UseNumber()
+		err = d.Decode(&raw)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decode configuration: %w", err)
+	}
+
+	err = errors.Join(checkCfgKeys(reflect.TypeOf(proxy.Config{}), raw, "")...)
+	if err != nil {
+		return err
+	}
+
+	// the other formats are converted to JSON, so the JSON names and types of the fields apply to all of them
+	data, err = json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("failed to decode configuration: %w", err)
+	}
+	err = json.Unmarshal(data, c)
+	if err != nil {
+		return fmt.Errorf("failed to decode configuration: %w", err)
+	}
+	return nil
+}
+
+func joinCfgPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// returns an error for every key of v that isn't a field of t, suggesting the closest field name
+func checkCfgKeys(t reflect.Type, v any, path string) []error {
+	var errs []error
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return checkCfgKeys(t.Elem(), v, path)
+	case reflect.Struct:
+		m, ok := v.(map[string]any)
+		if !ok {
+			// wrong types are reported when decoding
+			return nil
+		}
+
+		fields := make(map[string]reflect.StructField)
+		var names []string
+		for i := 0; i < t.NumField(); i++ {
+			if name := proxy.FieldName(t.Field(i)); name != "-" {
+				fields[name] = t.Field(i)
+				names = append(names, name)
+			}
+		}
+
+		keys := make([]string, 0, len(m))
+		for key := range m {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			sf, ok := fields[key]
+			if !ok {
+				msg := fmt.Sprintf("%s: unknown key", joinCfgPath(path, key))
+				if s := util.Suggest(key, names); s != "" {
+					msg += fmt.Sprintf(", did you mean %q?", s)
+				}
+				errs = append(errs, errors.New(msg))
+				continue
+			}
+			errs = append(errs, checkCfgKeys(sf.Type, m[key], joinCfgPath(path, key))...)
+		}
+	case reflect.Slice, reflect.Array:
+		list, _ := v.([]any)
+		for i, item := range list {
+			errs = append(errs, checkCfgKeys(t.Elem(), item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case reflect.Map:
+		m, _ := v.(map[string]any)
+		for key, item := range m {
+			errs = append(errs, checkCfgKeys(t.Elem(), item, joinCfgPath(path, key))...)
+		}
+	}
+	return errs
+}
+
+// encodes a configuration in the given format. YAML and TOML configurations are commented with the
+// descriptions of the fields.
+func encodeCfg(c proxy.Config, format string) ([]byte, error) {
+	var b bytes.Buffer
+
+	switch format {
+	case "yaml", "toml":
+		b.WriteString("# xelis-mining-proxy configuration\n")
+		writeCommentedCfg(&b, reflect.ValueOf(c), format, "", "")
+	default:
+		data, err := json.MarshalIndent(c, "", "\t")
+		if err != nil {
+			return nil, err
+		}
+		b.Write(data)
+		b.WriteByte('\n')
+	}
+	return b.Bytes(), nil
+}
+
+// writes a comment wrapped at CONFIG_COMMENT_WIDTH
+func writeComment(b *bytes.Buffer, indent, text string) {
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && len(indent)+2+len(line)+1+len(word) > CONFIG_COMMENT_WIDTH {
+			b.WriteString(indent + "# " + line + "\n")
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	if line != "" {
+		b.WriteString(indent + "# " + line + "\n")
+	}
+}
+
+// writes the fields of a struct with their descriptions. Nested structs are YAML mappings, or TOML tables
+// written after the other keys.
+func writeCommentedCfg(b *bytes.Buffer, v reflect.Value, format, indent, table string) {
+	t := v.Type()
+	var tables []int
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := proxy.FieldName(sf)
+		if name == "-" {
+			continue
+		}
+		if sf.Type.Kind() == reflect.Struct && format == "toml" {
+			tables = append(tables, i)
+			continue
+		}
+
+		b.WriteString("\n")
+		writeComment(b, indent, sf.Tag.Get("desc"))
+
+		// describe the fields of the items of lists of structs
+		if sf.Type.Kind() == reflect.Slice && sf.Type.Elem().Kind() == reflect.Struct {
+			et := sf.Type.Elem()
+			b.WriteString(indent + "# Each item has the keys:\n")
+			for j := 0; j < et.NumField(); j++ {
+				if n := proxy.FieldName(et.Field(j)); n != "-" {
+					writeComment(b, indent, "- "+n+": "+et.Field(j).Tag.Get("desc"))
+				}
+			}
+		}
+
+		switch {
+		case sf.Type.Kind() == reflect.Struct:
+			b.WriteString(indent + name + ":\n")
+			writeCommentedCfg(b, v.Field(i), format, indent+"  ", "")
+		case format == "toml":
+			b.WriteString(indent + name + " = " + tomlValue(v.Field(i)) + "\n")
+		default:
+			b.WriteString(indent + name + ": " + yamlValue(v.Field(i)) + "\n")
+		}
+	}
+
+	for _, i := range tables {
+		name := joinCfgPath(table, proxy.FieldName(t.Field(i)))
+		b.WriteString("\n")
+		writeComment(b, "", t.Field(i).Tag.Get("desc"))
+		b.WriteString("[" + name + "]\n")
+		writeCommentedCfg(b, v.Field(i), format, "", name)
+	}
+}
+
+// encodes a value in the YAML flow style, of which JSON is a subset
+func yamlValue(v reflect.Value) string {
+	if v.Kind() == reflect.Slice && v.Len() == 0 {
+		return "[]"
+	}
+	if v.Kind() == reflect.Map && v.Len() == 0 {
+		return "{}"
+	}
+	data, _ := json.Marshal(v.Interface())
+	return string(data)
+}
+
+// encodes a value as a TOML inline value
+func tomlValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = tomlValue(v.Index(i))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case reflect.Map:
+		var items []string
+		for _, k := range v.MapKeys() {
+			items = append(items, tomlKey(fmt.Sprint(k.Interface()))+" = "+tomlValue(v.MapIndex(k)))
+		}
+		slices.Sort(items)
+		return "{" + strings.Join(items, ", ") + "}"
+	case reflect.Struct:
+		var items []string
+		for i := 0; i < v.NumField(); i++ {
+			if name := proxy.FieldName(v.Type().Field(i)); name != "-" {
+				items = append(items, tomlKey(name)+" = "+tomlValue(v.Field(i)))
+			}
+		}
+		return "{" + strings.Join(items, ", ") + "}"
+	default:
+		// JSON strings, numbers and booleans are valid TOML
+		data, _ := json.Marshal(v.Interface())
+		return string(data)
+	}
+}
+
+func tomlKey(key string) string {
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			data, _ := json.Marshal(key)
+			return string(data)
+		}
+	}
+	return key
+}
+
+// example-config subcommand: prints an example configuration with the default values
+func exampleConfigCommand(args []string) int {
+	fs := flag.NewFlagSet("example-config", flag.ContinueOnError)
+	format := fs.String("format", "yaml", "format of the configuration: yaml, toml or json")
+
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xelis-mining-proxy example-config [flags]")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *format != "yaml" && *format != "toml" && *format != "json" {
+		fmt.Fprintln(os.Stderr, "unknown format:", *format)
+		return 2
+	}
+
+	data, err := encodeCfg(proxy.DefaultConfig(), *format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	os.Stdout.Write(data)
+	return 0
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+	"xelis-mining-proxy/log"
+	"xelis-mining-proxy/proxy"
+)
+
+// Configuration hot reload: config.json is watched, and reloaded on SIGHUP
+
+// interval at which config.json is checked for changes
+const CONFIG_WATCH_INTERVAL = 2 * time.Second
+
+// applies the environment variables and command-line flags, which take precedence over config.json
+var cmdlineOverrides = func(c *proxy.Config) error { return nil }
+
+var loggingFields = []string{"debug", "log_level", "log_levels", "log_format", "log_file", "log_max_size",
+	"log_rotate_interval", "log_max_files", "log_max_age"}
+
+func changed(fields []string, names ...string) bool {
+	for _, name := range names {
+		if slices.Contains(fields, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// reads config.json and applies it, without changing the running configuration if it is invalid
+func reloadCfg(p *proxy.Proxy) error {
+	data, err := os.ReadFile(cfgPath)
+	if err != nil {
+		return err
+	}
+
+	c := proxy.DefaultConfig()
+	err = decodeCfg(data, cfgFormat(cfgPath), &c)
+	if err != nil {
+		return err
+	}
+	err = cmdlineOverrides(&c)
+	if err != nil {
+		return err
+	}
+	c.Normalize()
+
+	err = c.Validate()
+	if err != nil {
+		return err
+	}
+
+	fields, changes := proxy.Diff(p.Config(), c)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	err = p.Reload(c)
+	if err != nil {
+		return err
+	}
+
+	if changed(fields, loggingFields...) {
+		if err := configureLogging(c); err != nil {
+			log.Err("invalid logging configuration:", err)
+		}
+	}
+	log.Info("Reloaded configuration:")
+	for _, v := range changes {
+		log.Info("  " + v)
+	}
+	if changed(fields, "tui") {
+		log.Warn("tui changed, restart the proxy to apply it")
+	}
+
+	return nil
+}
+
+// reloads the configuration when config.json changes, or on SIGHUP
+func watchCfg(p *proxy.Proxy) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	modTime := func() time.Time {
+		stat, err := os.Stat(cfgPath)
+		if err != nil {
+			return time.Time{}
+		}
+		return stat.ModTime()
+	}
+	lastMod := modTime()
+
+	ticker := time.NewTicker(CONFIG_WATCH_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hup:
+			log.Info("Received SIGHUP, reloading configuration")
+		case <-ticker.C:
+			mod := modTime()
+			if mod.Equal(lastMod) {
+				continue
+			}
+			lastMod = mod
+		}
+
+		if shuttingDown.Load() {
+			return
+		}
+
+		err := reloadCfg(p)
+		if err != nil {
+			log.Errf("invalid configuration, keeping the running configuration: %v", err)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"xelis-mining-proxy/proxy"
+)
+
+func TestFindCfgPathWorkingDir(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	if dirs := cfgSearchDirs(); len(dirs) == 0 || dirs[0] != dir {
+		t.Fatalf("search dirs %v; want %s first", dirs, dir)
+	}
+
+	want := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(want, []byte("wallet: xel:test\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got := findCfgPath(""); got != want {
+		t.Errorf("findCfgPath() = %s; want %s", got, want)
+	}
+	if got := findCfgPath("other.json"); got != "other.json" {
+		t.Errorf("findCfgPath(other.json) = %s; want the --config path", got)
+	}
+}
+
+func TestJournalDir(t *testing.T) {
+	prev := cfgPath
+	cfgPath = filepath.Join("/etc", "xelis-mining-proxy", "config.json")
+	t.Cleanup(func() { cfgPath = prev })
+
+	tests := map[string]string{
+		"":                     "",
+		"journal":              "/etc/xelis-mining-proxy/journal",
+		"/var/lib/xmp/journal": "/var/lib/xmp/journal",
+	}
+	for dir, want := range tests {
+		cfg := proxy.DefaultConfig()
+		cfg.JournalDir = dir
+		if got := journalDir(cfg); got != want {
+			t.Errorf("journalDir(%q) = %q; want %q", dir, got, want)
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+	"xelis-mining-proxy/log"
+	"xelis-mining-proxy/proxy"
+	"xelis-mining-proxy/util"
+
+	"github.com/TwiN/go-color"
+	"golang.org/x/term"
+)
+
+// Interactive console: live status screen in the terminal, and commands typed on the keyboard or read from stdin
+
+// number of log lines kept by the console
+const CONSOLE_LOG_LINES = 1000
+
+// minimum interval between two redraws of the console
+const CONSOLE_REDRAW_INTERVAL = 100 * time.Millisecond
+
+const CONSOLE_HELP = "h: hashrate | p <url>: switch pool | k [ip|worker] <miner>: kick | l [level]: log level | ctrl+c: quit"
+
+type Console struct {
+	proxy *proxy.Proxy
+
+	logs   []string
+	input  []byte
+	redraw chan struct{}
+
+	restore func()
+	closed  bool
+
+	sync.Mutex
+}
+
+// nil when the status screen is disabled
+var console *Console
+
+// starts the status screen if it is enabled and the terminal supports it, or reads commands from stdin
+func startConsole(p *proxy.Proxy) {
+	stdin, stdout := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+
+	if !p.Config().Tui {
+		go readCommands(p, os.Stdin)
+		return
+	}
+	if !term.IsTerminal(stdout) || !term.IsTerminal(stdin) {
+		log.Info("Not running in a terminal, using plain logs")
+		go readCommands(p, os.Stdin)
+		return
+	}
+
+	state, err := term.MakeRaw(stdin)
+	if err != nil {
+		log.Warn("failed to start the console, using plain logs:", err)
+		go readCommands(p, os.Stdin)
+		return
+	}
+
+	c := &Console{
+		proxy:  p,
+		redraw: make(chan struct{}, 1),
+	}
+	c.restore = func() {
+		os.Stdout.WriteString("\x1b[?25h\x1b[?1049l")
+		term.Restore(stdin, state)
+	}
+
+	// alternate screen, hidden cursor
+	os.Stdout.WriteString("\x1b[?1049h\x1b[?25l")
+
+	log.AddListener(c.addLog)
+	log.SetStdout(nil)
+	console = c
+
+	go c.readKeys()
+	go c.run()
+}
+
+// reads commands from stdin, one per line, and prints their output
+func readCommands(p *proxy.Proxy, r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		for _, line := range runCommand(p, scanner.Text()) {
+			fmt.Println(line)
+		}
+	}
+}
+
+// NOTE: this is called by the logger, so it must not log
+func (c *Console) addLog(line string) {
+	c.Lock()
+	c.logs = append(c.logs, line)
+	if len(c.logs) > CONSOLE_LOG_LINES {
+		c.logs = c.logs[len(c.logs)-CONSOLE_LOG_LINES:]
+	}
+	c.Unlock()
+
+	c.requestRedraw()
+}
+
+func (c *Console) requestRedraw() {
+	select {
+	case c.redraw <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Console) readKeys() {
+	buf := make([]byte, 256)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return
+		}
+
+		for i := 0; i < n; i++ {
+			b := buf[i]
+			switch {
+			case b == 3 || b == 4: // ctrl+c, ctrl+d
+				go shutdown(c.proxy)
+			case b == '\r' || b == '\n':
+				c.Lock()
+				line := string(c.input)
+				c.input = nil
+				c.Unlock()
+
+				if strings.TrimSpace(line) != "" {
+					out := runCommand(c.proxy, line)
+					c.Lock()
+					c.logs = append(c.logs, "> "+line)
+					for _, l := range out {
+						c.logs = append(c.logs, "  "+l)
+					}
+					c.Unlock()
+				}
+			case b == 127 || b == 8: // backspace
+				c.Lock()
+				if len(c.input) > 0 {
+					c.input = c.input[:len(c.input)-1]
+				}
+				c.Unlock()
+			case b == 0x1b: // skip escape sequences, such as arrow keys
+				if i+1 < n && buf[i+1] == '[' {
+					i += 2
+					for i < n && (buf[i] < 0x40 || buf[i] > 0x7e) {
+						i++
+					}
+				}
+			case b >= 32 && b < 127:
+				c.Lock()
+				c.input = append(c.input, b)
+				c.Unlock()
+			}
+		}
+		c.requestRedraw()
+	}
+}
+
+func (c *Console) run() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.redraw:
+		}
+		c.draw()
+		time.Sleep(CONSOLE_REDRAW_INTERVAL)
+	}
+}
+
+// returns the number of characters displayed by s, ignoring the color escape sequences
+func visibleLen(s string) int {
+	return utf8.RuneCountInString(log.StripColors(s))
+}
+
+// truncates s to the given number of visible characters
+func truncateLine(s string, width int) string {
+	if visibleLen(s) <= width {
+		return s
+	}
+
+	var b strings.Builder
+	n := 0
+	inEscape := false
+	for _, r := range s {
+		if r == '\x1b' {
+			inEscape = true
+		}
+		if inEscape {
+			b.WriteRune(r)
+			if r == 'm' {
+				inEscape = false
+			}
+			continue
+		}
+		if n == width {
+			break
+		}
+		b.WriteRune(r)
+		n++
+	}
+	return b.String() + color.Reset
+}
+
+func formatAge(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return time.Since(t).Round(time.Second).String() + " ago"
+}
+
+func (c *Console) draw() {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width, height = 80, 24
+	}
+
+	stats := c.proxy.Stats()
+	pool, job, rates := stats.Pool, stats.Job, stats.Hashrates
+	miners := c.proxy.Miners()
+
+	lines := []string{
+		color.InBold("XELIS Mining Proxy v"+proxy.VERSION) + color.InGray("  uptime "+
+			(time.Duration(stats.Uptime)*time.Second).String()),
+	}
+
+	state := color.InRed("disconnected")
+	if pool.Connected {
+		state = color.InGreen("connected") + " since " + pool.ConnectedSince.Format(time.TimeOnly)
+	}
+	lines = append(lines,
+		fmt.Sprintf("Pool   %s %s | %d pending | %d reconnects", pool.Url, state, pool.PendingShares, pool.Reconnects),
+		fmt.Sprintf("Job    height %d | difficulty %d | %s | received %s", job.Height, job.Difficulty, job.Algorithm,
+			formatAge(job.IssuedAt)),
+		fmt.Sprintf("Total  1m %s | 15m %s | 1h %s | %d miners | %d accepted, %d rejected, %d stale",
+			util.FormatHashrate(rates["1m"]), util.FormatHashrate(rates["15m"]), util.FormatHashrate(rates["1h"]),
+			len(miners), stats.Accepted, stats.Rejected, stats.Stale),
+	)
+	if len(stats.MissingWorkers) > 0 {
+		lines = append(lines, color.InRed("Missing workers: "+strings.Join(stats.MissingWorkers, ", ")))
+	}
+	lines = append(lines, "", color.InBold(fmt.Sprintf("%-5s %-20s %-8s %-15s %12s %9s %9s %6s  %s", "ID",
+		"WORKER", "PROTOCOL", "IP", "HASHRATE", "ACCEPTED", "REJECTED", "STALE", "LAST SHARE")))
+
+	maxMiners := max(3, height/3)
+	for i, m := range miners {
+		if i == maxMiners-1 && len(miners) > maxMiners {
+			lines = append(lines, color.InGray(fmt.Sprintf("... and %d more", len(miners)-i)))
+			break
+		}
+		worker := m.Worker
+		if worker == "" {
+			worker = m.IP
+		}
+		lines = append(lines, fmt.Sprintf("%-5d %-20s %-8s %-15s %12s %9d %9d %6d  %s", m.ID,
+			worker, m.Protocol, m.IP, util.FormatHashrate(m.Hashrate), m.Accepted, m.Rejected,
+			m.Stale, formatAge(m.LastShare)))
+	}
+	lines = append(lines, color.InGray("── "+CONSOLE_HELP+" "+strings.Repeat("─", max(0, width))))
+
+	c.Lock()
+	logLines := max(0, height-len(lines)-1)
+	logs := c.logs[max(0, len(c.logs)-logLines):]
+	for _, l := range logs {
+		switch {
+		case strings.HasPrefix(l, "> ") || strings.HasPrefix(l, "  "):
+			l = color.InCyan(l)
+		case strings.Contains(l, " E "):
+			l = color.InRed(l)
+		case strings.Contains(l, " W "):
+			l = color.InYellow(l)
+		}
+		lines = append(lines, l)
+	}
+	for i := len(logs); i < logLines; i++ {
+		lines = append(lines, "")
+	}
+	lines = append(lines, "> "+string(c.input)+"█")
+	c.Unlock()
+
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for i, l := range lines {
+		if i >= height {
+			break
+		}
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(truncateLine(l, width))
+		b.WriteString("\x1b[K")
+	}
+	b.WriteString("\x1b[J")
+
+	c.Lock()
+	if !c.closed {
+		os.Stdout.WriteString(b.String())
+	}
+	c.Unlock()
+}
+
+// restores the terminal and goes back to plain logs
+func (c *Console) close() {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.restore()
+	log.SetStdout(os.Stdout)
+}
+
+// Commands
+
+// runs a console command, and returns its output
+func runCommand(p *proxy.Proxy, line string) []string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	switch fields[0] {
+	case "h", "hashrate":
+		return hashrateSummary(p)
+	case "p", "pool":
+		if len(fields) < 2 {
+			return []string{"Pool: " + p.Stats().Pool.Url, "Usage: p <url>"}
+		}
+		if err := p.SwitchPool(fields[1]); err != nil {
+			return []string{"Invalid pool URL: " + err.Error()}
+		}
+		return []string{"Switching to pool " + p.Config().PoolUrl}
+	case "k", "kick":
+		// k <id>, or k <id|ip|worker> <value>
+		kind, target := proxy.KICK_ID, ""
+		switch len(fields) {
+		case 2:
+			target = fields[1]
+		case 3:
+			kind, target = fields[1], fields[2]
+		default:
+			return []string{"Usage: k <miner id>, k ip <IP>, k worker <worker>"}
+		}
+		n, err := p.Kick(kind, target)
+		if err != nil {
+			return []string{"Invalid kick: " + err.Error()}
+		}
+		if n == 0 {
+			return []string{"No miner matches " + kind + " " + target}
+		}
+		return []string{fmt.Sprintf("Kicked %d miners", n)}
+	case "l", "level":
+		level := log.GetLevel()
+		if len(fields) < 2 {
+			// cycle through info, debug and trace
+			level++
+			if level > log.LevelTrace {
+				level = log.LevelInfo
+			}
+		} else {
+			var err error
+			level, err = log.ParseLevel(fields[1])
+			if err != nil {
+				return []string{err.Error()}
+			}
+		}
+		log.SetLevel(level)
+		return []string{"Log level: " + level.String()}
+	default:
+		return []string{"Unknown command " + fields[0], CONSOLE_HELP}
+	}
+}
+
+func hashrateSummary(p *proxy.Proxy) []string {
+	rates := p.Stats().Hashrates
+	lines := []string{fmt.Sprintf("Total: 1m %s | 15m %s | 1h %s | 24h %s", util.FormatHashrate(rates["1m"]),
+		util.FormatHashrate(rates["15m"]), util.FormatHashrate(rates["1h"]), util.FormatHashrate(rates["24h"]))}
+
+	for _, w := range p.WorkerHashrates() {
+		lines = append(lines, fmt.Sprintf("%s: 1m %s | 15m %s | 1h %s | last share %s", w.Name,
+			util.FormatHashrate(w.Hashrates["1m"]), util.FormatHashrate(w.Hashrates["15m"]),
+			util.FormatHashrate(w.Hashrates["1h"]), formatAge(w.LastShare)))
+	}
+	return lines
+}
@@ -0,0 +1,170 @@
+// Package getwork is a client of the XELIS getwork protocol, used to connect to pools and nodes.
+//
+// Unlike the xelis-go-sdk client, Close can be called at any time, from any goroutine, without racing with the
+// connection reader.
+package getwork
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	NewJob        = "new_job"
+	BlockAccepted = "block_accepted"
+	BlockRejected = "block_rejected"
+)
+
+// BlockTemplate is a job sent by the pool
+type BlockTemplate struct {
+	Algorithm  string `json:"algorithm"`
+	Difficulty string `json:"difficulty"`
+	Height     uint64 `json:"height"`
+	TopoHeight uint64 `json:"topoheight"`
+	Template   string `json:"template"`
+	MinerWork  string `json:"miner_work"`
+}
+
+// Getwork is a connection to a getwork server. Its channels are closed when the connection is closed.
+type Getwork struct {
+	conn *websocket.Conn
+
+	Job           chan BlockTemplate
+	AcceptedBlock chan bool
+	RejectedBlock chan string
+	Err           chan error
+
+	writeMut  sync.Mutex
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewGetwork connects to the getwork endpoint of a pool or node, as the given miner address and worker
+func NewGetwork(endpoint, minerAddress, worker string) (*Getwork, error) {
+	socketUrl, err := url.Parse(fmt.Sprintf("%s/%s/%s", endpoint, minerAddress, worker))
+	if err != nil {
+		return nil, err
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(socketUrl.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Getwork{
+		conn:          conn,
+		Job:           make(chan BlockTemplate),
+		AcceptedBlock: make(chan bool),
+		RejectedBlock: make(chan string),
+		Err:           make(chan error, 1),
+		done:          make(chan struct{}),
+	}
+
+	go w.read()
+
+	return w, nil
+}
+
+// reads the messages until the connection is closed, then closes the channels
+func (w *Getwork) read() {
+	defer func() {
+		w.Close()
+		close(w.Job)
+		close(w.AcceptedBlock)
+		close(w.RejectedBlock)
+		close(w.Err)
+	}()
+
+	for {
+		_, msg, err := w.conn.ReadMessage()
+		if err != nil {
+			w.sendErr(err)
+			return
+		}
+
+		if !w.handleMessage(msg) {
+			return
+		}
+	}
+}
+
+// sends an error without blocking the reader if nobody reads them
+func (w *Getwork) sendErr(err error) {
+	select {
+	case w.Err <- err:
+	default:
+	}
+}
+
+// returns false if the connection was closed while delivering the message
+func (w *Getwork) handleMessage(msg []byte) bool {
+	var res any
+	err := json.Unmarshal(msg, &res)
+	if err != nil {
+		w.sendErr(err)
+		return true
+	}
+
+	switch v := res.(type) {
+	case string:
+		if v == BlockAccepted {
+			select {
+			case w.AcceptedBlock <- true:
+			case <-w.done:
+				return false
+			}
+		}
+	case map[string]any:
+		if raw, ok := v[NewJob]; ok {
+			// re-decode the job, the fields are known
+			var bt BlockTemplate
+			data, _ := json.Marshal(raw)
+			err := json.Unmarshal(data, &bt)
+			if err != nil {
+				w.sendErr(fmt.Errorf("invalid job: %w", err))
+				return true
+			}
+			if bt.Template == "" {
+				bt.Template = bt.MinerWork
+			}
+
+			select {
+			case w.Job <- bt:
+			case <-w.done:
+				return false
+			}
+		} else if reason, ok := v[BlockRejected].(string); ok {
+			select {
+			case w.RejectedBlock <- reason:
+			case <-w.done:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// SubmitBlock sends a hex encoded BlockMiner to the server
+func (w *Getwork) SubmitBlock(hexData string) error {
+	w.writeMut.Lock()
+	defer w.writeMut.Unlock()
+
+	return w.conn.WriteJSON(map[string]any{"block_template": hexData})
+}
+
+// Done returns a channel closed when the connection is closed
+func (w *Getwork) Done() <-chan struct{} {
+	return w.done
+}
+
+// Close closes the connection. The channels are closed once the reader stopped.
+func (w *Getwork) Close() {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		w.conn.Close()
+	})
+}
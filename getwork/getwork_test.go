@@ -0,0 +1,104 @@
+package getwork
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// starts a getwork server that sends the messages to every client, then waits for a submission
+func newServer(t *testing.T, messages ...string) (*httptest.Server, chan string) {
+	submitted := make(chan string, 1)
+	upgrader := websocket.Upgrader{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		for _, m := range messages {
+			conn.WriteMessage(websocket.TextMessage, []byte(m))
+		}
+
+		var sub map[string]string
+		if err := conn.ReadJSON(&sub); err == nil {
+			submitted <- sub["block_template"]
+		}
+	}))
+	return srv, submitted
+}
+
+func wsUrl(srv *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(srv.URL, "http") + "/getwork"
+}
+
+func TestGetwork(t *testing.T) {
+	srv, submitted := newServer(t,
+		`{"new_job":{"difficulty":"1000","height":5,"topoheight":6,"miner_work":"abcd","algorithm":"xel/v2"}}`,
+		`"block_accepted"`,
+		`{"block_rejected":"low diff"}`,
+	)
+	defer srv.Close()
+
+	w, err := NewGetwork(wsUrl(srv), "xel:addr", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	job := <-w.Job
+	if job.Difficulty != "1000" || job.Height != 5 || job.TopoHeight != 6 || job.Template != "abcd" ||
+		job.Algorithm != "xel/v2" {
+		t.Errorf("unexpected job %+v", job)
+	}
+	if !<-w.AcceptedBlock {
+		t.Error("expected an accepted block")
+	}
+	if reason := <-w.RejectedBlock; reason != "low diff" {
+		t.Errorf("rejection reason = %q; want \"low diff\"", reason)
+	}
+
+	if err := w.SubmitBlock("ef01"); err != nil {
+		t.Fatal(err)
+	}
+	if s := <-submitted; s != "ef01" {
+		t.Errorf("submitted %q; want \"ef01\"", s)
+	}
+}
+
+func TestCloseWhileDelivering(t *testing.T) {
+	srv, _ := newServer(t, `{"new_job":{"difficulty":"1","height":1,"template":"00"}}`)
+	defer srv.Close()
+
+	w, err := NewGetwork(wsUrl(srv), "xel:addr", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nobody reads the job: closing must unblock the reader and close the channels
+	time.Sleep(50 * time.Millisecond)
+	w.Close()
+	w.Close()
+
+	select {
+	case <-w.Done():
+	default:
+		t.Fatal("Done not closed after Close")
+	}
+
+	select {
+	case _, ok := <-w.Job:
+		for ok {
+			_, ok = <-w.Job
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channels not closed after Close")
+	}
+}
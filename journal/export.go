@@ -0,0 +1,119 @@
+package journal
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Summary aggregates the entries of a worker
+type Summary struct {
+	Worker    string
+	Submitted uint64
+	Forwarded uint64
+	Accepted  uint64
+	Rejected  uint64
+	TimedOut  uint64
+	Stale     uint64
+	Work      float64 // sum of the difficulty of the accepted shares
+
+	roundTripSum   float64
+	roundTripCount uint64
+}
+
+// AvgRoundTrip returns the average pool round trip of the answered shares, in milliseconds
+func (s *Summary) AvgRoundTrip() float64 {
+	if s.roundTripCount == 0 {
+		return 0
+	}
+	return s.roundTripSum / float64(s.roundTripCount)
+}
+
+func (s *Summary) add(e Entry) {
+	switch e.Event {
+	case EventSubmitted:
+		s.Submitted++
+	case EventForwarded:
+		s.Forwarded++
+	case EventAccepted:
+		s.Accepted++
+		s.Work += float64(e.Difficulty)
+	case EventRejected:
+		s.Rejected++
+	case EventTimedOut:
+		s.TimedOut++
+	case EventStale:
+		s.Stale++
+	}
+
+	if e.RoundTrip > 0 {
+		s.roundTripSum += e.RoundTrip
+		s.roundTripCount++
+	}
+}
+
+// Summarize returns the summary of every worker, and the total of all the workers
+func Summarize(dir string, filter Filter) ([]*Summary, *Summary, error) {
+	workers := make(map[string]*Summary)
+	total := &Summary{Worker: "total"}
+
+	err := Read(dir, filter, func(e Entry) error {
+		s := workers[e.Worker]
+		if s == nil {
+			s = &Summary{Worker: e.Worker}
+			workers[e.Worker] = s
+		}
+		s.add(e)
+		total.add(e)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	list := make([]*Summary, 0, len(workers))
+	for _, s := range workers {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Worker < list[j].Worker
+	})
+	return list, total, nil
+}
+
+var csvHeader = []string{"time", "event", "protocol", "miner", "worker", "wallet", "share", "height", "difficulty",
+	"rtt_ms", "reason"}
+
+// WriteCSV exports the entries matching the filter as CSV
+func WriteCSV(w io.Writer, dir string, filter Filter) error {
+	cw := csv.NewWriter(w)
+
+	err := cw.Write(csvHeader)
+	if err != nil {
+		return err
+	}
+
+	err = Read(dir, filter, func(e Entry) error {
+		return cw.Write([]string{
+			e.Time.Format(time.RFC3339Nano),
+			e.Event,
+			e.Protocol,
+			e.Miner,
+			e.Worker,
+			e.Wallet,
+			e.Share,
+			strconv.FormatUint(e.Height, 10),
+			strconv.FormatUint(e.Difficulty, 10),
+			strconv.FormatFloat(e.RoundTrip, 'f', 3, 64),
+			e.Reason,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,302 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Share events
+const (
+	EventSubmitted = "submitted" // received from a miner
+	EventForwarded = "forwarded" // sent to the pool
+	EventAccepted  = "accepted"
+	EventRejected  = "rejected" // by the pool or by the proxy, see Reason
+	EventTimedOut  = "timed_out"
+	EventStale     = "stale"
+)
+
+// Entry is a share event
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Event      string    `json:"event"`
+	Protocol   string    `json:"protocol,omitempty"`
+	Miner      string    `json:"miner"`
+	Worker     string    `json:"worker,omitempty"`
+	Wallet     string    `json:"wallet,omitempty"`
+	Share      string    `json:"share,omitempty"`
+	Height     uint64    `json:"height,omitempty"`
+	Difficulty uint64    `json:"difficulty,omitempty"`
+	RoundTrip  float64   `json:"rtt_ms,omitempty"` // milliseconds between submission and pool response
+	Reason     string    `json:"reason,omitempty"`
+}
+
+const filePrefix = "shares-"
+const fileSuffix = ".jsonl"
+
+// size of the queue of entries waiting to be written
+const queueSize = 4096
+
+// Journal appends share events to one JSON lines file per day in a directory.
+// Files older than MaxAge, or exceeding MaxSize in total, are removed.
+type Journal struct {
+	Dir     string
+	MaxAge  time.Duration // 0 for no limit
+	MaxSize int64         // maximum total size in bytes, 0 for no limit
+
+	queue   chan Entry
+	done    chan struct{}
+	dropped uint64
+
+	file   *os.File
+	writer *bufio.Writer
+	day    string
+	closed bool
+	mu     sync.Mutex
+}
+
+// Open creates the journal directory and starts the writer
+func Open(dir string, maxAge time.Duration, maxSize int64) (*Journal, error) {
+	err := os.MkdirAll(dir, 0o750)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &Journal{
+		Dir:     dir,
+		MaxAge:  maxAge,
+		MaxSize: maxSize,
+		queue:   make(chan Entry, queueSize),
+		done:    make(chan struct{}),
+	}
+	j.cleanup()
+
+	go j.run()
+
+	return j, nil
+}
+
+// Append queues an entry without blocking. Entries are dropped if the queue is full, and discarded once the
+// journal is closed.
+func (j *Journal) Append(e Entry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.closed {
+		return
+	}
+	select {
+	case j.queue <- e:
+	default:
+		j.dropped++
+	}
+}
+
+// Dropped returns the number of entries dropped because the queue was full
+func (j *Journal) Dropped() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.dropped
+}
+
+func (j *Journal) run() {
+	defer close(j.done)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case e, ok := <-j.queue:
+			if !ok {
+				j.flush()
+				if j.file != nil {
+					j.file.Close()
+				}
+				return
+			}
+			j.write(e)
+		case <-ticker.C:
+			j.flush()
+		}
+	}
+}
+
+func (j *Journal) write(e Entry) {
+	day := e.Time.UTC().Format("2006-01-02")
+	if day != j.day || j.file == nil {
+		j.flush()
+		if j.file != nil {
+			j.file.Close()
+			j.file = nil
+		}
+
+		f, err := os.OpenFile(filepath.Join(j.Dir, filePrefix+day+fileSuffix), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+		if err != nil {
+			return
+		}
+		j.file = f
+		j.writer = bufio.NewWriter(f)
+		j.day = day
+		j.cleanup()
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	j.writer.Write(append(data, '\n'))
+}
+
+func (j *Journal) flush() {
+	if j.writer != nil {
+		j.writer.Flush()
+	}
+}
+
+// Close writes the queued entries and closes the journal
+func (j *Journal) Close() {
+	j.mu.Lock()
+	if !j.closed {
+		j.closed = true
+		close(j.queue)
+	}
+	j.mu.Unlock()
+
+	<-j.done
+}
+
+// returns the journal files of a directory, oldest first
+func listFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), filePrefix) && strings.HasSuffix(e.Name(), fileSuffix) {
+			files = append(files, e.Name())
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// removes the files exceeding MaxAge or MaxSize, except the current one
+func (j *Journal) cleanup() {
+	files, err := listFiles(j.Dir)
+	if err != nil {
+		return
+	}
+
+	var total int64
+	for i := len(files) - 1; i >= 0; i-- {
+		name := files[i]
+		if strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix) == j.day {
+			continue
+		}
+
+		stat, err := os.Stat(filepath.Join(j.Dir, name))
+		if err != nil {
+			continue
+		}
+		total += stat.Size()
+
+		if (j.MaxAge > 0 && time.Since(stat.ModTime()) > j.MaxAge) || (j.MaxSize > 0 && total > j.MaxSize) {
+			os.Remove(filepath.Join(j.Dir, name))
+		}
+	}
+}
+
+// Filter selects entries when reading a journal. Zero values match everything.
+type Filter struct {
+	From   time.Time
+	To     time.Time
+	Worker string
+	Event  string
+}
+
+func (f Filter) Match(e Entry) bool {
+	if !f.From.IsZero() && e.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !e.Time.Before(f.To) {
+		return false
+	}
+	if f.Worker != "" && e.Worker != f.Worker {
+		return false
+	}
+	if f.Event != "" && e.Event != f.Event {
+		return false
+	}
+	return true
+}
+
+var ErrNoJournal = errors.New("no journal files found")
+
+// Read calls fn for every entry of the journal in dir that matches the filter, in chronological order
+func Read(dir string, filter Filter, fn func(e Entry) error) error {
+	files, err := listFiles(dir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return ErrNoJournal
+	}
+
+	for _, name := range files {
+		day, err := time.Parse("2006-01-02", strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix))
+		if err == nil {
+			// skip the files outside of the time range
+			if !filter.To.IsZero() && !day.Before(filter.To) {
+				continue
+			}
+			if !filter.From.IsZero() && day.Add(24*time.Hour).Before(filter.From) {
+				continue
+			}
+		}
+
+		err = readFile(filepath.Join(dir, name), filter, fn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readFile(path string, filter Filter, fn func(e Entry) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			// ignore partially written lines
+			continue
+		}
+		if !filter.Match(e) {
+			continue
+		}
+		err = fn(e)
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
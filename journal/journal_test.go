@@ -0,0 +1,84 @@
+package journal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJournal(t *testing.T) {
+	dir := t.TempDir()
+
+	j, err := Open(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 5, 1, 23, 59, 0, 0, time.UTC)
+	events := []Entry{
+		{Event: EventSubmitted, Worker: "rig1", Share: "a"},
+		{Event: EventForwarded, Worker: "rig1", Share: "a"},
+		{Event: EventAccepted, Worker: "rig1", Share: "a", Difficulty: 1000, RoundTrip: 20},
+		{Event: EventSubmitted, Worker: "rig2", Share: "b"},
+		{Event: EventRejected, Worker: "rig2", Share: "b", Reason: "low diff", RoundTrip: 40},
+		{Event: EventStale, Worker: "rig2"},
+	}
+	for i, e := range events {
+		// the entries span two days, so two files
+		e.Time = start.Add(time.Duration(i) * 30 * time.Second)
+		j.Append(e)
+	}
+	j.Close()
+
+	files, err := listFiles(dir)
+	if err != nil || len(files) != 2 {
+		t.Fatalf("expected 2 journal files, got %v (%v)", files, err)
+	}
+
+	workers, total, err := Summarize(dir, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(workers) != 2 || total.Accepted != 1 || total.Rejected != 1 || total.Stale != 1 || total.Submitted != 2 {
+		t.Fatalf("unexpected summary %+v", total)
+	}
+	if workers[0].Work != 1000 || workers[0].AvgRoundTrip() != 20 {
+		t.Fatalf("unexpected summary of rig1 %+v", workers[0])
+	}
+
+	// filters
+	_, total, err = Summarize(dir, Filter{Worker: "rig2", From: start.Add(100 * time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total.Submitted != 0 || total.Rejected != 1 || total.Stale != 1 {
+		t.Fatalf("unexpected filtered summary %+v", total)
+	}
+
+	var buf bytes.Buffer
+	err = WriteCSV(&buf, dir, Filter{Event: EventRejected})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], "low diff") {
+		t.Fatalf("unexpected CSV:\n%s", buf.String())
+	}
+}
+
+func TestJournalAppendAfterClose(t *testing.T) {
+	j, err := Open(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	// the entries of the shares answered during a shutdown are discarded
+	j.Append(Entry{Event: EventAccepted, Worker: "rig1"})
+	j.Close()
+
+	if j.Dropped() != 0 {
+		t.Errorf("%d entries dropped; want 0", j.Dropped())
+	}
+}
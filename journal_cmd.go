@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"xelis-mining-proxy/journal"
+	"xelis-mining-proxy/proxy"
+)
+
+// parses a time given as RFC 3339, as a date (2006-01-02), or as a duration before now (24h)
+func parseJournalTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
+
+// returns the journal directory of the configuration, relative paths being in the directory of the configuration
+// file like in the proxy
+func journalDir(cfg proxy.Config) string {
+	if cfg.JournalDir == "" || filepath.IsAbs(cfg.JournalDir) {
+		return cfg.JournalDir
+	}
+	return filepath.Join(path(), cfg.JournalDir)
+}
+
+// journal subcommand: filters and summarizes the share journal, or exports it as CSV. journalDir is the default
+// of --dir.
+func journalCommand(args []string, journalDir string) int {
+	fs := flag.NewFlagSet("journal", flag.ContinueOnError)
+
+	dir := fs.String("dir", journalDir, "journal directory")
+	from := fs.String("from", "", "start of the time range (RFC 3339, 2006-01-02, or a duration before now like 24h)")
+	to := fs.String("to", "", "end of the time range (RFC 3339, 2006-01-02, or a duration before now like 1h)")
+	worker := fs.String("worker", "", "only show this worker")
+	event := fs.String("event", "", "only show this event (submitted, forwarded, accepted, rejected, timed_out, stale)")
+	csv := fs.Bool("csv", false, "export the entries as CSV instead of summarizing them")
+	out := fs.String("out", "", "CSV output file, standard output if empty")
+
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xelis-mining-proxy journal [flags]")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *dir == "" {
+		fmt.Fprintln(os.Stderr, "the share journal is disabled: set journal_dir in the config or use --dir")
+		return 1
+	}
+
+	var filter journal.Filter
+	var err error
+	filter.From, err = parseJournalTime(*from)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid --from:", err)
+		return 2
+	}
+	filter.To, err = parseJournalTime(*to)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid --to:", err)
+		return 2
+	}
+	filter.Worker = *worker
+	filter.Event = *event
+
+	if *csv {
+		w := os.Stdout
+		if *out != "" {
+			w, err = os.Create(*out)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			defer w.Close()
+		}
+
+		err = journal.WriteCSV(w, *dir, filter)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	workers, total, err := journal.Summarize(*dir, filter)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, strings.Join([]string{"WORKER", "SUBMITTED", "FORWARDED", "ACCEPTED", "REJECTED", "TIMED OUT",
+		"STALE", "WORK", "AVG RTT (ms)", ""}, "\t"))
+	for _, s := range append(workers, total) {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%.0f\t%.1f\t\n", s.Worker, s.Submitted, s.Forwarded, s.Accepted,
+			s.Rejected, s.TimedOut, s.Stale, s.Work, s.AvgRoundTrip())
+	}
+	tw.Flush()
+
+	return 0
+}
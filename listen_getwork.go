@@ -1,245 +0,0 @@
-package main
-
-import (
-	"encoding/hex"
-	"encoding/json"
-	"flag"
-	"net/http"
-	"strconv"
-	"time"
-	"sync"
-	"xelis-mining-proxy/log"
-	"xelis-mining-proxy/util"
-
-	"github.com/gorilla/websocket"
-	"github.com/xelis-project/xelis-go-sdk/getwork"
-)
-
-// Getwork server
-
-var upgrader = websocket.Upgrader{} // use default options
-
-func fmtMessageType(mt int) string {
-	switch mt {
-	case websocket.BinaryMessage:
-		return "binary"
-	case websocket.TextMessage:
-		return "text"
-	default:
-		return "Unknown Message Type"
-	}
-}
-
-type GetworkConn struct {
-	conn *websocket.Conn
-
-	sync.RWMutex
-}
-
-// GetworkConn MUST be locked before calling this
-func (g *GetworkConn) WriteJSON(data interface{}) error {
-	return g.conn.WriteJSON(data)
-}
-
-func (g *GetworkConn) IP() string {
-	return g.conn.RemoteAddr().String()
-}
-
-func (g *GetworkConn) Close() error {
-	return g.conn.Close()
-}
-
-var socketsMut sync.RWMutex
-var sockets []*GetworkConn
-
-// sends a job to all the websockets, and removes old websockets
-func sendJobToWebsocket(diff uint64, bl []byte) {
-	socketsMut.Lock()
-	defer socketsMut.Unlock()
-
-	log.Debug("sendJobToWebsocket: num sockets:", len(sockets))
-
-	// remove disconnected sockets
-
-	sockets2 := make([]*GetworkConn, 0, len(sockets))
-	for _, c := range sockets {
-		if c == nil {
-			continue
-		}
-		sockets2 = append(sockets2, c)
-	}
-	log.Debug("sendJobToWebsocket: going from", len(sockets), "to", len(sockets2), "getwork miners")
-	sockets = sockets2
-
-	if len(sockets) > 0 {
-		log.Info("Sending job to", len(sockets), "GetWork miners")
-	}
-
-	// send jobs to the remaining sockets
-
-	for ix, cx := range sockets {
-		if cx == nil {
-			log.Debug("cx is nil")
-			continue
-		}
-
-		i := ix
-		c := cx
-
-		// send job in a new thread to avoid blocking the main thread and reduce latency
-		go func() {
-			c.Lock()
-			defer c.Unlock()
-
-			err := c.WriteJSON(map[string]any{
-				"new_job": getwork.MinerWork{
-					Difficulty: strconv.FormatUint(diff, 10),
-					MinerWork:  hex.EncodeToString(bl[:]),
-					Algorithm:  curJob.Algorithm,
-					Height:     curJob.Height,
-					TopoHeight: curJob.TopoHeight,
-				},
-			})
-
-			// if write failed, close the connection (if it isn't already closed) and remove it from
-			// the list of sockets
-			if err != nil {
-				log.Warn("sendJobToWebsocket: cannot send job:", err)
-				c.Close()
-
-				socketsMut.Lock()
-				sockets[i] = nil
-				socketsMut.Unlock()
-				return
-			}
-			log.Debug("sendJobToWebsocket: done, sent to IP", c.IP())
-		}()
-	}
-}
-
-func listenGetwork() {
-	flag.Parse()
-
-	http.HandleFunc("/", wsHandler)
-
-	ip := "0.0.0.0:" + strconv.FormatUint(uint64(Cfg.GetworkBindPort), 10)
-
-	log.Info("Getwork server listening on port", Cfg.GetworkBindPort)
-
-	log.Fatal(http.ListenAndServe(ip, nil))
-}
-
-func wsHandler(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Warn("upgrade:", err)
-		return
-	}
-	defer conn.Close()
-
-	log.Info("Miner with IP", conn.RemoteAddr().String(), "connected to Getwork")
-
-	socketsMut.Lock()
-	c := &GetworkConn{conn: conn}
-	sockets = append(sockets, c)
-	socketsMut.Unlock()
-
-	// send first job
-	mutCurJob.Lock()
-	if curJob.Diff == 0 {
-		log.Debug("not sending first job, because there is no first job yet")
-		mutCurJob.Unlock()
-		return
-	}
-
-	log.Debug("sending first job")
-
-	diff := strconv.FormatUint(curJob.Diff, 10)
-	blob := curJob.Blob
-	mutCurJob.Unlock()
-
-	c.Lock()
-	err = c.WriteJSON(map[string]any{
-		"new_job": getwork.MinerWork{
-			Difficulty: diff,
-			MinerWork:  hex.EncodeToString(blob[:]),
-			Algorithm:  curJob.Algorithm,
-			Height:     curJob.Height,
-			TopoHeight: curJob.TopoHeight,
-		},
-	})
-	c.Unlock()
-	if err != nil {
-		log.Warn("failed to send first job:", err)
-	}
-	// done sending first job
-
-	log.Debug("done sending first job")
-
-	for {
-		mt, message, err := c.conn.ReadMessage()
-		if err != nil {
-			log.Info("Getwork miner disconnected:", err)
-			break
-		}
-
-		log.Debugf("recv: %s, type: %s", message, fmtMessageType(mt))
-
-		var msgJson map[string]any
-
-		err = json.Unmarshal([]byte(message), &msgJson)
-
-		if err != nil {
-			log.Err(err)
-		}
-
-		if msgJson["miner_work"] == nil {
-			if msgJson["block_template"] == nil {
-				log.Debug("miner_work and block_template are nil")
-				continue
-			} else {
-				msgJson["miner_work"] = msgJson["block_template"]
-			}
-		}
-
-		minerWork := msgJson["miner_work"].(string)
-
-		minerBlob, err := hex.DecodeString(minerWork)
-		if err != nil {
-			log.Err(err)
-			continue
-		}
-
-		if len(minerBlob) != util.BLOCKMINER_LENGTH {
-			log.Warnf("miner blob %x length is invalid", minerBlob)
-			continue
-		}
-
-		// Extract share ID from the minerBlob (BlockMiner structure)
-		shareID, err := ExtractShareID(minerBlob)
-		if err != nil {
-			log.Err("failed to extract share ID:", err)
-			continue
-		}
-
-		log.Infof("Getwork miner %s found share", c.IP())
-
-		// Create pending share to await pool response
-		responseChan := make(chan ShareResult, 1)
-		pending := &PendingShare{
-			GetworkConn:  c,
-			SubmittedAt:  time.Now(),
-			ResponseChan: responseChan,
-		}
-
-		// Register pending share and start response waiter
-		shareTracker.AddPendingShare(shareID, pending)
-		shareTracker.StartResponseWaiter(shareID, pending)
-
-		// send share to pool with ID for correlation
-		sharesToPool <- Share{
-			ID:      shareID,
-			Encoded: minerWork,
-		}
-	}
-}
@@ -1,75 +1,411 @@
 package log
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"regexp"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/TwiN/go-color"
 )
 
-var LogLevel uint8 = 0
+// Level is the verbosity of a log line. Greater levels are more verbose.
+type Level uint8
 
-func prefix() string {
-	x := time.Now().Local().Format("2006-01-02 15:04:05 ")
+const (
+	LevelError Level = iota
+	LevelWarn
+	LevelInfo
+	LevelDebug
+	LevelTrace // protocol messages
+)
+
+var levelNames = []string{"error", "warn", "info", "debug", "trace"}
+
+func (l Level) String() string {
+	if int(l) < len(levelNames) {
+		return levelNames[l]
+	}
+	return strconv.Itoa(int(l))
+}
+
+// ParseLevel parses a level name (error, warn, info, debug, trace)
+func ParseLevel(s string) (Level, error) {
+	for i, v := range levelNames {
+		if strings.EqualFold(s, v) {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+// default level of the components without their own level
+var LogLevel = LevelInfo
+
+var mut sync.RWMutex
+var componentLevels = map[string]Level{}
+var jsonFormat bool
+var colors = isTerminal(os.Stdout)
+var fileSink io.WriteCloser
+var stdout io.Writer = os.Stdout
+
+type listener struct {
+	f func(line string)
+}
+
+var listeners []*listener
+
+// AddListener registers a function that receives every log line, without colors. The returned function removes it.
+func AddListener(f func(line string)) (remove func()) {
+	mut.Lock()
+	defer mut.Unlock()
+
+	l := &listener{f}
+	listeners = append(listeners, l)
+	return func() {
+		mut.Lock()
+		defer mut.Unlock()
+
+		listeners = slices.DeleteFunc(listeners, func(v *listener) bool {
+			return v == l
+		})
+	}
+}
+
+// SetLevel sets the default level of the components
+func SetLevel(l Level) {
+	mut.Lock()
+	defer mut.Unlock()
+
+	LogLevel = l
+}
+
+// GetLevel returns the default level of the components
+func GetLevel() Level {
+	mut.RLock()
+	defer mut.RUnlock()
+
+	return LogLevel
+}
+
+// SetStdout sets the writer of the console output, nil disables it
+func SetStdout(w io.Writer) {
+	mut.Lock()
+	defer mut.Unlock()
+
+	if w == nil {
+		w = io.Discard
+	}
+	stdout = w
+}
+
+// SetComponentLevel sets the level of a component, overriding LogLevel
+func SetComponentLevel(component string, l Level) {
+	mut.Lock()
+	defer mut.Unlock()
+
+	componentLevels[component] = l
+}
+
+// ResetComponentLevels removes the levels set with SetComponentLevel
+func ResetComponentLevels() {
+	mut.Lock()
+	defer mut.Unlock()
+
+	componentLevels = map[string]Level{}
+}
+
+// SetJSON enables or disables the JSON output format
+func SetJSON(enabled bool) {
+	mut.Lock()
+	defer mut.Unlock()
+
+	jsonFormat = enabled
+}
+
+// SetFile sets the file sink, which receives every log line without colors. nil disables it.
+func SetFile(w io.WriteCloser) {
+	mut.Lock()
+	defer mut.Unlock()
+
+	if fileSink != nil {
+		fileSink.Close()
+	}
+	fileSink = w
+}
+
+// Close flushes and closes the file sink
+func Close() {
+	SetFile(nil)
+}
+
+// returns true if the file is a terminal, so colors can be used
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+func levelFor(component string) Level {
+	mut.RLock()
+	defer mut.RUnlock()
+
+	if l, ok := componentLevels[component]; ok {
+		return l
+	}
+	return LogLevel
+}
+
+var ansiRegexp = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// StripColors removes the color escape sequences of s
+func StripColors(s string) string {
+	return ansiRegexp.ReplaceAllString(s, "")
+}
+
+// Fields are the structured fields attached to a log line
+type Fields struct {
+	Component string `json:"component,omitempty"`
+	Miner     string `json:"miner,omitempty"`
+	Share     string `json:"share,omitempty"`
+	Height    uint64 `json:"height,omitempty"`
+}
+
+type jsonEntry struct {
+	Time   string `json:"time"`
+	Level  string `json:"level"`
+	Caller string `json:"caller,omitempty"`
+	Fields
+	Msg string `json:"msg"`
+}
+
+var letters = []string{"E ", "W ", "I ", "D ", "T "}
+var levelColors = []string{color.Red, color.Yellow, "", color.Cyan, color.Gray}
+
+// returns the file and line of the log call
+func caller(skip int) string {
+	_, file, line, _ := runtime.Caller(skip)
+	fileSpl := strings.Split(file, "/")
+	return strings.Split(fileSpl[len(fileSpl)-1], ".")[0] + ":" + strconv.FormatInt(int64(line), 10)
+}
+
+// writes a log line. skip is the number of stack frames between the caller and output.
+func output(l Level, f Fields, msg string, skip int) {
+	now := time.Now().Local()
+	showCaller := levelFor(f.Component) >= LevelDebug
 
-	if LogLevel != 0 {
-		_, file, line, _ := runtime.Caller(2)
-		fileSpl := strings.Split(file, "/")
-		debugInfos := strings.Split(fileSpl[len(fileSpl)-1], ".")[0] + ":" + strconv.FormatInt(int64(line), 10)
+	msg = strings.TrimRight(msg, "\n")
+
+	// text format
+	prefix := now.Format("2006-01-02 15:04:05 ")
+	if showCaller {
+		debugInfos := caller(skip + 1)
 		for len(debugInfos) < 20 {
 			debugInfos = debugInfos + " "
 		}
-		x += debugInfos
+		prefix += debugInfos
+	}
+	body := letters[l]
+	if f.Component != "" {
+		body += "[" + f.Component + "] "
+	}
+	body += msg
+	text := prefix + body
+
+	mut.RLock()
+
+	var line string
+	if jsonFormat {
+		e := jsonEntry{
+			Time:   now.Format(time.RFC3339Nano),
+			Level:  l.String(),
+			Fields: f,
+			Msg:    StripColors(msg),
+		}
+		if showCaller {
+			e.Caller = caller(skip + 1)
+		}
+		data, _ := json.Marshal(e)
+		line = string(data) + "\n"
+		fmt.Fprint(stdout, line)
+	} else {
+		line = StripColors(text) + "\n"
+		if colors && levelColors[l] != "" {
+			fmt.Fprint(stdout, prefix+color.Ize(levelColors[l], body)+"\n")
+		} else if colors {
+			fmt.Fprint(stdout, text+"\n")
+		} else {
+			fmt.Fprint(stdout, line)
+		}
 	}
 
-	return x
+	if fileSink != nil {
+		fileSink.Write([]byte(line))
+	}
+
+	// the listeners are called without the lock, so that a listener can remove itself and a slow one doesn't block
+	// the configuration of the logger
+	ls := slices.Clone(listeners)
+	mut.RUnlock()
+
+	if len(ls) == 0 {
+		return
+	}
+	stripped := StripColors(text)
+	for _, l := range ls {
+		l.f(stripped)
+	}
+}
+
+// Logger writes log lines with structured fields
+type Logger struct {
+	fields Fields
 }
 
+// Component returns a Logger for a component (stratum, getwork, upstream, tracker...), which can have
+// its own level
+func Component(name string) *Logger {
+	return &Logger{
+		fields: Fields{Component: name},
+	}
+}
+
+// Miner returns a copy of the Logger with the miner IP field set
+func (l *Logger) Miner(ip string) *Logger {
+	n := *l
+	n.fields.Miner = ip
+	return &n
+}
+
+// Share returns a copy of the Logger with the share ID field set
+func (l *Logger) Share(id string) *Logger {
+	n := *l
+	n.fields.Share = id
+	return &n
+}
+
+// Height returns a copy of the Logger with the job height field set
+func (l *Logger) Height(h uint64) *Logger {
+	n := *l
+	n.fields.Height = h
+	return &n
+}
+
+func (l *Logger) log(lvl Level, msg string) {
+	if levelFor(l.fields.Component) < lvl {
+		return
+	}
+	output(lvl, l.fields, msg, 3)
+}
+
+func (l *Logger) Info(a ...any) {
+	l.log(LevelInfo, fmt.Sprintln(a...))
+}
+func (l *Logger) Infof(format string, a ...any) {
+	l.log(LevelInfo, fmt.Sprintf(format, a...))
+}
+
+func (l *Logger) Warn(a ...any) {
+	l.log(LevelWarn, fmt.Sprintln(a...))
+}
+func (l *Logger) Warnf(format string, a ...any) {
+	l.log(LevelWarn, fmt.Sprintf(format, a...))
+}
+
+func (l *Logger) Err(a ...any) {
+	l.log(LevelError, fmt.Sprintln(a...))
+}
+func (l *Logger) Errf(format string, a ...any) {
+	l.log(LevelError, fmt.Sprintf(format, a...))
+}
+
+func (l *Logger) Debug(a ...any) {
+	l.log(LevelDebug, fmt.Sprintln(a...))
+}
+func (l *Logger) Debugf(format string, a ...any) {
+	l.log(LevelDebug, fmt.Sprintf(format, a...))
+}
+
+func (l *Logger) Trace(a ...any) {
+	l.log(LevelTrace, fmt.Sprintln(a...))
+}
+func (l *Logger) Tracef(format string, a ...any) {
+	l.log(LevelTrace, fmt.Sprintf(format, a...))
+}
+
+func (l *Logger) Fatal(a ...any) {
+	output(LevelError, l.fields, fmt.Sprintln(a...), 2)
+	panic(a)
+}
+
+// the logger used by the package-level functions, without component
+var std = &Logger{}
+
 func Title(a ...any) {
-	fmt.Print("  " + fmt.Sprintln(a...))
+	mut.RLock()
+	defer mut.RUnlock()
+
+	if jsonFormat {
+		return
+	}
+
+	line := "  " + fmt.Sprintln(a...)
+	if colors {
+		fmt.Fprint(stdout, line)
+	} else {
+		fmt.Fprint(stdout, StripColors(line))
+	}
+	if fileSink != nil {
+		fileSink.Write([]byte(StripColors(line)))
+	}
 }
 
 func Info(a ...any) {
-	fmt.Print(prefix() + "I " + fmt.Sprintln(a...))
+	std.log(LevelInfo, fmt.Sprintln(a...))
 }
 func Infof(format string, a ...any) {
-	fmt.Print(prefix() + fmt.Sprintf("I "+format+"\n", a...))
+	std.log(LevelInfo, fmt.Sprintf(format, a...))
 }
 
 func Warn(a ...any) {
-	fmt.Print(prefix() + color.Ize(color.Yellow, "W "+fmt.Sprintln(a...)))
+	std.log(LevelWarn, fmt.Sprintln(a...))
 }
 func Warnf(format string, a ...any) {
-	fmt.Print(prefix() + color.Ize(color.Yellow, fmt.Sprintf("W "+format+"\n", a...)))
+	std.log(LevelWarn, fmt.Sprintf(format, a...))
 }
 
 func Err(a ...any) {
-	fmt.Print(prefix() + color.Ize(color.Red, "E "+fmt.Sprintln(a...)))
+	std.log(LevelError, fmt.Sprintln(a...))
 }
 
 func Errf(format string, a ...any) {
-	fmt.Print(prefix() + color.Ize(color.Red, fmt.Sprintf("E "+format+"\n", a...)))
+	std.log(LevelError, fmt.Sprintf(format, a...))
 }
 
 func Fatal(a ...any) {
-	fmt.Print(prefix() + color.Ize(color.Red, "E "+fmt.Sprintln(a...)))
+	output(LevelError, std.fields, fmt.Sprintln(a...), 2)
 	panic(a)
 }
 
 func Debug(a ...any) {
-	if LogLevel < 1 {
-		return
-	}
-
-	fmt.Print(prefix() + color.Ize(color.Cyan, "D "+fmt.Sprintln(a...)))
+	std.log(LevelDebug, fmt.Sprintln(a...))
 }
 func Debugf(format string, a ...any) {
-	if LogLevel < 1 {
-		return
-	}
+	std.log(LevelDebug, fmt.Sprintf(format, a...))
+}
 
-	fmt.Print(prefix() + color.Ize(color.Cyan, fmt.Sprintf("D "+format+"\n", a...)))
+func Trace(a ...any) {
+	std.log(LevelTrace, fmt.Sprintln(a...))
+}
+func Tracef(format string, a ...any) {
+	std.log(LevelTrace, fmt.Sprintf(format, a...))
 }
@@ -0,0 +1,143 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotatingFile is a log file that is rotated when it reaches a maximum size, or after an interval.
+// Rotated files are renamed to <path>.<timestamp>, and removed when there are more than MaxFiles of them
+// or when they are older than MaxAge.
+type RotatingFile struct {
+	Path     string
+	MaxSize  int64         // maximum size in bytes, 0 for no limit
+	Interval time.Duration // rotation interval, 0 to disable time-based rotation
+	MaxFiles int           // maximum number of rotated files kept, 0 for no limit
+	MaxAge   time.Duration // maximum age of rotated files, 0 for no limit
+
+	file   *os.File
+	size   int64
+	opened time.Time
+
+	mu sync.Mutex
+}
+
+// OpenRotatingFile opens (or creates) the log file at path
+func OpenRotatingFile(path string, maxSize int64, interval time.Duration, maxFiles int, maxAge time.Duration) (*RotatingFile, error) {
+	r := &RotatingFile{
+		Path:     path,
+		MaxSize:  maxSize,
+		Interval: interval,
+		MaxFiles: maxFiles,
+		MaxAge:   maxAge,
+	}
+
+	err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.file = f
+	r.size = stat.Size()
+	r.opened = time.Now()
+	return nil
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if (r.MaxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.MaxSize) ||
+		(r.Interval > 0 && time.Since(r.opened) >= r.Interval) {
+		err := r.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// RotatingFile MUST be locked before calling this
+func (r *RotatingFile) rotate() error {
+	err := r.file.Close()
+	if err != nil {
+		return err
+	}
+
+	rotated := r.Path + "." + time.Now().Format("20060102-150405.000")
+	err = os.Rename(r.Path, rotated)
+	if err != nil {
+		return err
+	}
+
+	r.cleanup()
+	return r.open()
+}
+
+// removes the rotated files exceeding MaxFiles or MaxAge
+func (r *RotatingFile) cleanup() {
+	matches, err := filepath.Glob(r.Path + ".*")
+	if err != nil {
+		return
+	}
+
+	rotated := make([]string, 0, len(matches))
+	for _, m := range matches {
+		if strings.HasPrefix(m, r.Path+".") {
+			rotated = append(rotated, m)
+		}
+	}
+	// timestamps sort chronologically, newest last
+	sort.Strings(rotated)
+
+	for i, m := range rotated {
+		remove := r.MaxFiles > 0 && i < len(rotated)-r.MaxFiles
+
+		if !remove && r.MaxAge > 0 {
+			if stat, err := os.Stat(m); err == nil && time.Since(stat.ModTime()) > r.MaxAge {
+				remove = true
+			}
+		}
+
+		if remove {
+			os.Remove(m)
+		}
+	}
+}
+
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
@@ -0,0 +1,85 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "proxy.log")
+
+	r, err := OpenRotatingFile(path, 100, 0, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	line := strings.Repeat("x", 39) + "\n"
+	for i := 0; i < 10; i++ {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		// rotated files are named after the time of rotation
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Size() > 100 {
+		t.Errorf("log file size %d exceeds the maximum size", stat.Size())
+	}
+
+	rotated, _ := filepath.Glob(path + ".*")
+	if len(rotated) != 2 {
+		t.Errorf("expected 2 rotated files, got %d: %v", len(rotated), rotated)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for i, name := range levelNames {
+		l, err := ParseLevel(strings.ToUpper(name))
+		if err != nil || l != Level(i) {
+			t.Errorf("ParseLevel(%q) = %v, %v", name, l, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
+
+func TestListenerRemovesItself(t *testing.T) {
+	SetStdout(nil)
+	t.Cleanup(func() { SetStdout(os.Stdout) })
+
+	lines := make(chan string, 2)
+	var remove func()
+	remove = AddListener(func(line string) {
+		lines <- line
+		remove()
+	})
+
+	done := make(chan struct{})
+	go func() {
+		Info("first")
+		Info("second")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("logging from a listener removing itself deadlocked")
+	}
+
+	if n := len(lines); n != 1 {
+		t.Fatalf("listener got %d lines; want 1", n)
+	}
+	if line := <-lines; !strings.HasSuffix(line, "first") {
+		t.Errorf("listener got %q; want the first line", line)
+	}
+}
@@ -1,93 +1,159 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"io/fs"
 	"os"
 	"runtime"
 	"strings"
 	"xelis-mining-proxy/log"
+	"xelis-mining-proxy/proxy"
 
 	"github.com/TwiN/go-color"
 )
 
+func StringPrompt(label string) string {
+	var s string
+	r := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Fprint(os.Stderr, label+" ")
+		s, _ = r.ReadString('\n')
+		if s != "" {
+			break
+		}
+	}
+	return strings.TrimSpace(s)
+}
+
 func main() {
-	walletAddr := ""
-	url := ""
-	protocol := ""
-	debug := false
+	cfg := proxy.DefaultConfig()
+
+	if len(os.Args) > 1 && os.Args[1] == "journal" {
+		// the journal directory of the configuration is the default of --dir
+		cfgPath = findCfgPath("")
+		loadCfg(&cfg)
+		os.Exit(journalCommand(os.Args[2:], journalDir(cfg)))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "example-config" {
+		os.Exit(exampleConfigCommand(os.Args[2:]))
+	}
+
+	configFile := ""
 	save := false
+	checkConfig := false
+	printCfg := false
 
-	flag.StringVar(&walletAddr, "wallet", "", "your xelis address")
-	flag.StringVar(&url, "url", "", "mining pool url")
-	flag.StringVar(&protocol, "protocol", "", "mining pool protocol, possible values: xatum, getwork")
-	flag.BoolVar(&debug, "debug", false, "true if you want to make logs verbose")
+	registerCfgFlags(flag.CommandLine)
+	flag.StringVar(&configFile, "config", "", "path of the configuration file")
 	flag.BoolVar(&save, "save-config", false, "force saving the config to a json file")
+	flag.BoolVar(&checkConfig, "check-config", false, "validate the configuration and exit")
+	flag.BoolVar(&printCfg, "print-config", false, "print the effective configuration and exit")
 	flag.Parse()
 
-	if debug || Cfg.Debug {
-		log.Info("debug mode ON")
-		Cfg.Debug = true
-		log.LogLevel = 2
+	cfgPath = findCfgPath(configFile)
+	cfgLoadErr := loadCfg(&cfg)
+	cfgFound := cfgLoadErr == nil
+
+	// without a configuration file, the defaults are used with the environment and the flags. A file given with
+	// --config must exist, unless it is created with --save-config.
+	if errors.Is(cfgLoadErr, fs.ErrNotExist) && (configFile == "" || save) {
+		cfgLoadErr = nil
+	}
+	cmdlineOverrides = applyCfgOverrides
+	if cfgLoadErr == nil {
+		cfgLoadErr = cmdlineOverrides(&cfg)
+	}
+
+	if printCfg {
+		if cfgLoadErr != nil {
+			fmt.Fprintln(os.Stderr, "invalid configuration:", cfgLoadErr)
+			os.Exit(1)
+		}
+		printConfig(cfg)
+		os.Exit(0)
 	}
-	if walletAddr != "" && walletAddr != "YOUR_WALLET_ADDRESS" {
-		Cfg.WalletAddress = walletAddr
+	if checkConfig {
+		os.Exit(checkConfigCommand(cfg, cfgLoadErr))
 	}
-	if url != "" {
-		Cfg.PoolUrl = url
+	if cfgLoadErr != nil {
+		log.Err(cfgLoadErr)
+		log.Close()
+		os.Exit(1)
 	}
-	if protocol != "" {
-		Cfg.PoolProtocol = protocol
+
+	if err := configureLogging(cfg); err != nil {
+		log.Err("invalid logging configuration:", err)
+	}
+	if cfg.Debug {
+		log.Info("debug mode ON")
+	}
+	if cfgFound {
+		log.Info("Loaded configuration from", cfgPath)
+	} else {
+		log.Info("No configuration file found, using the defaults")
 	}
 	if save {
-		saveCfg()
+		if err := saveCfg(cfg); err != nil {
+			log.Err("failed to save configuration:", err)
+		}
 	}
 
-	if Cfg.WalletAddress == "YOUR_WALLET_ADDRESS" {
-		Cfg.WalletAddress = StringPrompt("Enter your wallet address:")
+	if cfg.WalletAddress == "YOUR_WALLET_ADDRESS" {
+		cfg.WalletAddress = StringPrompt("Enter your wallet address:")
 
-		if len(Cfg.WalletAddress) > 10 {
-			saveCfg()
+		if err := proxy.ValidateAddress(cfg.WalletAddress, cfg.Network); err == nil {
+			if err := saveWallet(cfg.WalletAddress); err != nil {
+				log.Err("failed to save the wallet address:", err)
+			}
 		} else {
-			log.Err("invalid wallet address")
+			log.Err("invalid wallet address:", err)
+			log.Close()
 			os.Exit(0)
 		}
 	}
 
 	log.Title("")
-	log.Title(color.InBold("XELIS-MINING-PROXY v" + VERSION))
+	log.Title(color.InBold("XELIS-MINING-PROXY v" + proxy.VERSION))
 	log.Title(color.Ize(color.Purple, "https://github.com/xelis-project/xelis-mining-proxy"))
 	log.Title("")
 	log.Title(color.Cyan+"OS:", runtime.GOOS, "arch:", runtime.GOARCH, "threads:", runtime.NumCPU())
 	log.Title(color.Reset + "")
 
-	Cfg.PoolProtocol = strings.ToLower(Cfg.PoolProtocol)
+	if cfg.Normalize() {
+		log.Info("Automatically selected protocol:", cfg.PoolProtocol)
+	} else {
+		log.Info("Using pool protocol:", cfg.PoolProtocol)
+	}
 
-	switch Cfg.PoolProtocol {
-	case "stratum", "getwork":
-		log.Info("Using pool protocol:", Cfg.PoolProtocol)
-	case "auto":
-		Cfg.PoolProtocol = "stratum"
-		splUrl := strings.Split(Cfg.PoolUrl, ":")
-		if len(splUrl) > 2 {
-			splUrl = splUrl[1:]
-		}
+	p, err := proxy.New(proxy.Options{
+		Config:     cfg,
+		DataDir:    path(),
+		SaveWallet: saveWallet,
+	})
+	if err != nil {
+		log.Err("invalid configuration:\n" + err.Error())
+		log.Close()
+		os.Exit(1)
+	}
 
-		if len(splUrl) > 1 {
-			port := splUrl[1]
+	startConsole(p)
+	handleShutdownSignals(p)
 
-			if port == "8080" || port == "2086" {
-				Cfg.PoolProtocol = "getwork"
-			}
+	err = p.Start(context.Background())
+	if err != nil {
+		if console != nil {
+			console.close()
 		}
-		log.Info("Automatically selected protocol:", Cfg.PoolProtocol)
+		log.Err(err)
+		log.Close()
+		os.Exit(1)
 	}
 
-	go listenGetwork()
-	go listenStratum(stratumServer)
+	go watchCfg(p)
 
-	if Cfg.PoolProtocol == "getwork" {
-		getworkClientHandler()
-	} else {
-		panic("stratum pools not implemented yet")
-	}
+	select {}
 }
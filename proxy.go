@@ -1,42 +0,0 @@
-package main
-
-import (
-	"bufio"
-	"fmt"
-	"os"
-	"strings"
-	"sync"
-	"xelis-mining-proxy/util"
-)
-
-const VERSION = "1.1.0"
-
-// Job is a fast & efficient struct used for storing a job in memory
-type Job struct {
-	Blob       util.BlockMiner
-	Diff       uint64
-	Target     [32]byte
-	Height     uint64
-	TopoHeight uint64
-	Algorithm  string
-}
-
-var stratumServer = &StratumServer{
-	Conns: make([]*StratumConn, 0),
-}
-
-func StringPrompt(label string) string {
-	var s string
-	r := bufio.NewReader(os.Stdin)
-	for {
-		fmt.Fprint(os.Stderr, label+" ")
-		s, _ = r.ReadString('\n')
-		if s != "" {
-			break
-		}
-	}
-	return strings.TrimSpace(s)
-}
-
-var curJob Job
-var mutCurJob sync.RWMutex
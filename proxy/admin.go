@@ -0,0 +1,432 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"xelis-mining-proxy/log"
+	"xelis-mining-proxy/util"
+)
+
+// Admin API: runtime control of the proxy under /api/admin, protected by bearer tokens. Every action is written
+// to the audit log.
+
+var adminLog = log.Component("admin")
+
+// AuditEntry is a line of the audit log
+type AuditEntry struct {
+	Time   time.Time         `json:"time"`
+	Actor  string            `json:"actor"` // fingerprint of the token
+	IP     string            `json:"ip"`
+	Action string            `json:"action"`
+	Params map[string]string `json:"params,omitempty"`
+	Result string            `json:"result"`
+}
+
+// returns the path of the audit log, relative paths being in the data directory
+func (p *Proxy) auditLogPath() string {
+	file := p.getCfg().AdminAuditLog
+	if file == "" || filepath.IsAbs(file) {
+		return file
+	}
+	return p.dataPath(file)
+}
+
+// writes an admin action to the logs and to the audit log
+func (p *Proxy) audit(e AuditEntry) {
+	actor := e.Actor
+	if actor == "" {
+		actor = "unknown"
+	}
+	params := make([]string, 0, len(e.Params))
+	for k, v := range e.Params {
+		params = append(params, k+"="+v)
+	}
+	sort.Strings(params)
+	adminLog.Infof("%s by %s from %s %s: %s", e.Action, actor, e.IP, strings.Join(params, " "), e.Result)
+
+	file := p.auditLogPath()
+	if file == "" {
+		return
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		adminLog.Err(err)
+		return
+	}
+
+	p.mutAudit.Lock()
+	defer p.mutAudit.Unlock()
+
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		adminLog.Err("failed to write the audit log:", err)
+		return
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	if err != nil {
+		adminLog.Err("failed to write the audit log:", err)
+	}
+}
+
+// returns a short fingerprint of a token, to identify it in the audit log without revealing it
+func tokenFingerprint(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:4])
+}
+
+// returns the fingerprint of the bearer token of the request, or an empty string if it isn't an admin token
+func (p *Proxy) adminActor(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return ""
+	}
+
+	for _, t := range p.getCfg().AdminTokens {
+		if t != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			return tokenFingerprint(t)
+		}
+	}
+	return ""
+}
+
+// adminError is an error of an admin action, returned with its HTTP status
+type adminError struct {
+	status int
+	msg    string
+}
+
+func (e *adminError) Error() string {
+	return e.msg
+}
+
+func badRequest(msg string) error {
+	return &adminError{http.StatusBadRequest, msg}
+}
+
+// decodes the JSON body of an admin request
+func readAdminBody(r *http.Request, v any) error {
+	err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<16)).Decode(v)
+	if err != nil {
+		return badRequest("invalid request body: " + err.Error())
+	}
+	return nil
+}
+
+// registers an admin endpoint. The handler fills the parameters written to the audit log, and returns the
+// response or an error. Only the actions changing the state of the proxy are audited.
+func (p *Proxy) handleAdmin(mux *http.ServeMux, pattern, action string,
+	h func(r *http.Request, params map[string]string) (any, error)) {
+	audited := !strings.HasPrefix(pattern, "GET ")
+
+	mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		if len(p.getCfg().AdminTokens) == 0 {
+			writeApiError(w, http.StatusNotFound, "the admin API is disabled")
+			return
+		}
+
+		ip := util.RemovePort(r.RemoteAddr)
+		actor := p.adminActor(r)
+		if actor == "" {
+			adminLog.Warnf("unauthorized admin request %s %s from %s", r.Method, r.URL.Path, ip)
+			if audited {
+				p.audit(AuditEntry{Time: time.Now(), IP: ip, Action: action, Result: "unauthorized"})
+			}
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeApiError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		params := make(map[string]string)
+		res, err := h(r, params)
+
+		if audited {
+			result := "ok"
+			if err != nil {
+				result = err.Error()
+			}
+			p.audit(AuditEntry{Time: time.Now(), Actor: actor, IP: ip, Action: action, Params: params, Result: result})
+		}
+
+		if err != nil {
+			status := http.StatusInternalServerError
+			var ae *adminError
+			if errors.As(err, &ae) {
+				status = ae.status
+			}
+			writeApiError(w, status, err.Error())
+			return
+		}
+		if res == nil {
+			res = map[string]string{"result": "ok"}
+		}
+		writeApiJSON(w, http.StatusOK, res)
+	})
+}
+
+func (p *Proxy) registerAdminApi(mux *http.ServeMux) {
+	p.handleAdmin(mux, "GET /api/admin/miners", "list_miners", p.adminListMiners)
+	p.handleAdmin(mux, "POST /api/admin/miners/{miner}/kick", "kick", p.adminKick)
+	p.handleAdmin(mux, "GET /api/admin/bans", "list_bans", p.adminListBans)
+	p.handleAdmin(mux, "PUT /api/admin/bans/{kind}/{value}", "ban", p.adminBan)
+	p.handleAdmin(mux, "DELETE /api/admin/bans/{kind}/{value}", "unban", p.adminUnban)
+	p.handleAdmin(mux, "POST /api/admin/pool", "switch_pool", p.adminSwitchPool)
+	p.handleAdmin(mux, "POST /api/admin/wallet", "change_wallet", p.adminChangeWallet)
+	p.handleAdmin(mux, "POST /api/admin/log-level", "log_level", p.adminLogLevel)
+	p.handleAdmin(mux, "POST /api/admin/rebroadcast", "rebroadcast", p.adminRebroadcast)
+	p.handleAdmin(mux, "POST /api/admin/forwarding", "forwarding", p.adminForwarding)
+}
+
+func (p *Proxy) adminListMiners(r *http.Request, params map[string]string) (any, error) {
+	return p.Miners(), nil
+}
+
+func (p *Proxy) adminKick(r *http.Request, params map[string]string) (any, error) {
+	miner := r.PathValue("miner")
+	params["miner"] = miner
+
+	kind := r.URL.Query().Get("kind")
+	if kind == "" {
+		kind = KICK_ID
+	}
+	params["kind"] = kind
+
+	n, err := p.Kick(kind, miner)
+	if err != nil {
+		return nil, badRequest(err.Error())
+	}
+	if n == 0 {
+		return nil, &adminError{http.StatusNotFound, "miner not found"}
+	}
+	return map[string]int{"kicked": n}, nil
+}
+
+func (p *Proxy) adminListBans(r *http.Request, params map[string]string) (any, error) {
+	return p.listBans(), nil
+}
+
+// returns the kind and value of the ban of a request, with the IPs in the form of the IPs of the miners
+func banParams(r *http.Request, params map[string]string) (string, string, error) {
+	kind, value := r.PathValue("kind"), r.PathValue("value")
+	params[kind] = value
+
+	switch kind {
+	case BAN_WORKER:
+		return kind, value, nil
+	case BAN_IP:
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return "", "", badRequest("invalid IP " + strconv.Quote(value))
+		}
+		return kind, addr.Unmap().WithZone("").String(), nil
+	default:
+		return "", "", badRequest("the ban kind must be ip or worker")
+	}
+}
+
+func (p *Proxy) adminBan(r *http.Request, params map[string]string) (any, error) {
+	kind, value, err := banParams(r, params)
+	if err != nil {
+		return nil, err
+	}
+	if !p.ban(kind, value) {
+		return nil, &adminError{http.StatusConflict, "already banned"}
+	}
+	return nil, nil
+}
+
+func (p *Proxy) adminUnban(r *http.Request, params map[string]string) (any, error) {
+	kind, value, err := banParams(r, params)
+	if err != nil {
+		return nil, err
+	}
+	if !p.unban(kind, value) {
+		return nil, &adminError{http.StatusNotFound, "not banned"}
+	}
+	return nil, nil
+}
+
+func (p *Proxy) adminSwitchPool(r *http.Request, params map[string]string) (any, error) {
+	var body struct {
+		Url string `json:"url"`
+	}
+	if err := readAdminBody(r, &body); err != nil {
+		return nil, err
+	}
+	params["url"] = body.Url
+
+	if body.Url == "" {
+		return nil, badRequest("missing url")
+	}
+	if err := p.SwitchPool(body.Url); err != nil {
+		return nil, badRequest(err.Error())
+	}
+	return nil, nil
+}
+
+func (p *Proxy) adminChangeWallet(r *http.Request, params map[string]string) (any, error) {
+	var body struct {
+		Wallet string `json:"wallet"`
+	}
+	if err := readAdminBody(r, &body); err != nil {
+		return nil, err
+	}
+	params["wallet"] = body.Wallet
+
+	if err := ValidateAddress(body.Wallet, p.getCfg().Network); err != nil {
+		return nil, badRequest(err.Error())
+	}
+
+	p.mutCfg.Lock()
+	p.cfg.WalletAddress = body.Wallet
+	p.mutCfg.Unlock()
+
+	log.Info("Changed the wallet address to", body.Wallet)
+	p.reconnectPool()
+
+	// saved after the change, so the reload of the saved file finds the same wallet
+	warning := "the wallet address isn't saved, it is reverted when the configuration is reloaded"
+	if p.saveWallet != nil {
+		err := p.saveWallet(body.Wallet)
+		if err == nil {
+			return nil, nil
+		}
+		adminLog.Warn("failed to save the wallet address:", err)
+		warning = "failed to save the wallet address, it is reverted when the configuration is reloaded: " + err.Error()
+	}
+	return map[string]string{"result": "ok", "warning": warning}, nil
+}
+
+func (p *Proxy) adminLogLevel(r *http.Request, params map[string]string) (any, error) {
+	var body struct {
+		Level     string `json:"level"`
+		Component string `json:"component"`
+	}
+	if err := readAdminBody(r, &body); err != nil {
+		return nil, err
+	}
+	params["level"] = body.Level
+	if body.Component != "" {
+		params["component"] = body.Component
+	}
+
+	level, err := log.ParseLevel(body.Level)
+	if err != nil {
+		return nil, badRequest(err.Error())
+	}
+	if body.Component == "" {
+		log.SetLevel(level)
+	} else {
+		log.SetComponentLevel(body.Component, level)
+	}
+	return nil, nil
+}
+
+func (p *Proxy) adminRebroadcast(r *http.Request, params map[string]string) (any, error) {
+	// the miners are being disconnected, and the jobs are no longer sent
+	if p.shuttingDown.Load() {
+		return nil, &adminError{http.StatusServiceUnavailable, "the proxy is shutting down"}
+	}
+	if p.defaultSession.getJob().Diff == 0 {
+		return nil, &adminError{http.StatusConflict, "no job received from the pool yet"}
+	}
+
+	for _, s := range p.listSessions() {
+		if job := s.getJob(); job.Diff != 0 {
+			go p.sendJobToWebsocket(s, job)
+			go p.sendStratumJobs(s, job, true)
+		}
+	}
+	return nil, nil
+}
+
+func (p *Proxy) adminForwarding(r *http.Request, params map[string]string) (any, error) {
+	var body struct {
+		Paused *bool `json:"paused"`
+	}
+	if err := readAdminBody(r, &body); err != nil {
+		return nil, err
+	}
+	if body.Paused == nil {
+		return nil, badRequest("missing paused")
+	}
+	params["paused"] = strconv.FormatBool(*body.Paused)
+
+	p.forwardingPaused.Store(*body.Paused)
+	if *body.Paused {
+		log.Warn("Share forwarding paused, the shares are rejected until it is resumed")
+	} else {
+		log.Info("Share forwarding resumed")
+	}
+	return nil, nil
+}
+
+// kind of Kick matching the miner ID, the other kinds are BAN_IP and BAN_WORKER
+const KICK_ID = "id"
+
+// Kick disconnects the miners whose ID, IP or worker name, depending on kind (KICK_ID, BAN_IP or BAN_WORKER), is
+// target, and returns the number of disconnected miners. It returns an error if the kind or target is invalid.
+func (p *Proxy) Kick(kind, target string) (int, error) {
+	var match func(id uint64, worker, ip string) bool
+	switch kind {
+	case KICK_ID:
+		id, err := strconv.ParseUint(target, 10, 64)
+		if err != nil {
+			return 0, errors.New("invalid miner ID " + strconv.Quote(target))
+		}
+		match = func(minerID uint64, _, _ string) bool { return minerID == id }
+	case BAN_IP:
+		addr, err := netip.ParseAddr(target)
+		if err != nil {
+			return 0, errors.New("invalid IP " + strconv.Quote(target))
+		}
+		target = addr.Unmap().WithZone("").String()
+		match = func(_ uint64, _, ip string) bool { return ip == target }
+	case BAN_WORKER:
+		match = func(_ uint64, worker, _ string) bool { return worker == target }
+	default:
+		return 0, errors.New("the kick kind must be id, ip or worker")
+	}
+	n := 0
+
+	p.stratumServer.RLock()
+	for _, c := range p.stratumServer.Conns {
+		c.Lock()
+		if c.Alive && match(c.ID, workerName(c.Worker, c.IP), c.IP) {
+			log.Info("Kicking stratum miner", c.ID, "with IP", c.IP)
+			c.Close()
+			n++
+		}
+		c.Unlock()
+	}
+	p.stratumServer.RUnlock()
+
+	p.socketsMut.RLock()
+	for _, c := range p.sockets {
+		if c == nil {
+			continue
+		}
+		ip := util.RemovePort(c.IP())
+		if match(c.ID, workerName(c.Worker, ip), ip) {
+			log.Info("Kicking getwork miner", c.ID, "with IP", c.IP())
+			c.Close()
+			n++
+		}
+	}
+	p.socketsMut.RUnlock()
+
+	return n, nil
+}
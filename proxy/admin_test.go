@@ -0,0 +1,295 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"xelis-mining-proxy/util"
+
+	"github.com/gorilla/websocket"
+)
+
+const TEST_ADMIN_TOKEN = "tok-0123456789abcdef"
+
+// creates a proxy with the admin API enabled, which isn't started
+func newAdminTestProxy(t *testing.T) *Proxy {
+	cfg := DefaultConfig()
+	cfg.WalletAddress = TEST_WALLET
+	cfg.PoolUrl = "127.0.0.1:8080"
+	cfg.AdminTokens = []string{TEST_ADMIN_TOKEN}
+	cfg.AdminAuditLog = "audit.log"
+
+	p, err := New(Options{Config: cfg, DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// sends an admin request from an IPv6 client, and returns the response
+func adminResponse(p *Proxy, method, path, token, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.RemoteAddr = "[2001:db8::7]:4000"
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	p.apiMux.ServeHTTP(w, r)
+	return w
+}
+
+// sends an admin request from an IPv6 client, and returns the response status
+func adminRequest(p *Proxy, method, path, token, body string) int {
+	return adminResponse(p, method, path, token, body).Code
+}
+
+// returns the lines of the audit log
+func readAudit(t *testing.T, p *Proxy) []AuditEntry {
+	f, err := os.Open(p.auditLogPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.Contains(scanner.Text(), TEST_ADMIN_TOKEN) {
+			t.Error("the token is written to the audit log")
+		}
+
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestAdminAuth(t *testing.T) {
+	p := newAdminTestProxy(t)
+
+	tests := []struct {
+		method   string
+		token    string
+		expected int
+	}{
+		{"GET", "", http.StatusUnauthorized},
+		{"GET", "wrong-token-0123456789", http.StatusUnauthorized},
+		{"GET", TEST_ADMIN_TOKEN[:16], http.StatusUnauthorized},
+		{"GET", TEST_ADMIN_TOKEN, http.StatusOK},
+		{"POST", "", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		path := "/api/admin/miners"
+		if test.method == "POST" {
+			path = "/api/admin/rebroadcast"
+		}
+		if status := adminRequest(p, test.method, path, test.token, ""); status != test.expected {
+			t.Errorf("%s %s with token %q: status %d; want %d", test.method, path, test.token, status, test.expected)
+		}
+	}
+
+	// only the unauthorized action is audited, not the reads
+	entries := readAudit(t, p)
+	if len(entries) != 1 || entries[0].Action != "rebroadcast" || entries[0].Result != "unauthorized" ||
+		entries[0].IP != "2001:db8::7" || entries[0].Actor != "" {
+		t.Errorf("unexpected audit log %+v", entries)
+	}
+
+	p.cfg.AdminTokens = nil
+	if status := adminRequest(p, "GET", "/api/admin/miners", TEST_ADMIN_TOKEN, ""); status != http.StatusNotFound {
+		t.Errorf("disabled admin API: status %d; want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestAdminBans(t *testing.T) {
+	p := newAdminTestProxy(t)
+
+	tests := []struct {
+		method   string
+		path     string
+		expected int
+	}{
+		{"PUT", "/api/admin/bans/ip/2001:0db8:0:0::1", http.StatusOK},
+		{"PUT", "/api/admin/bans/ip/2001:db8::1", http.StatusConflict},
+		{"PUT", "/api/admin/bans/ip/::ffff:10.0.0.5", http.StatusOK},
+		{"PUT", "/api/admin/bans/ip/not-an-ip", http.StatusBadRequest},
+		{"PUT", "/api/admin/bans/wallet/rig1", http.StatusBadRequest},
+		{"PUT", "/api/admin/bans/worker/rig1", http.StatusOK},
+		{"PUT", "/api/admin/bans/worker/rig2", http.StatusOK},
+		{"DELETE", "/api/admin/bans/worker/rig2", http.StatusOK},
+		{"DELETE", "/api/admin/bans/worker/rig2", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		if status := adminRequest(p, test.method, test.path, TEST_ADMIN_TOKEN, ""); status != test.expected {
+			t.Errorf("%s %s: status %d; want %d", test.method, test.path, status, test.expected)
+		}
+	}
+
+	// the bans match the IPs of the miners, as found in their address
+	banned := []string{"[2001:db8::1]:5000", "10.0.0.5:5000", "[::ffff:10.0.0.5]:5000"}
+	for _, addr := range banned {
+		if !p.isIPBanned(util.RemovePort(addr)) {
+			t.Errorf("miner at %s isn't banned", addr)
+		}
+	}
+	if p.isIPBanned(util.RemovePort("[2001:db8::2]:5000")) {
+		t.Error("miner at [2001:db8::2]:5000 is banned")
+	}
+	if !p.isWorkerBanned("rig1") || p.isWorkerBanned("rig2") {
+		t.Error("unexpected worker bans")
+	}
+
+	// the bans are saved
+	saved := &Proxy{dataDir: p.dataDir, bannedIPs: make(map[string]bool), bannedWorkers: make(map[string]bool)}
+	saved.loadBans()
+	bans := saved.listBans()
+	if strings.Join(bans.IPs, ",") != "10.0.0.5,2001:db8::1" || strings.Join(bans.Workers, ",") != "rig1" {
+		t.Errorf("unexpected saved bans %+v", bans)
+	}
+
+	entries := readAudit(t, p)
+	if len(entries) != len(tests) {
+		t.Fatalf("%d audit log lines; want %d", len(entries), len(tests))
+	}
+	e := entries[0]
+	if e.Actor != tokenFingerprint(TEST_ADMIN_TOKEN) || e.IP != "2001:db8::7" || e.Action != "ban" ||
+		e.Params["ip"] != "2001:0db8:0:0::1" || e.Result != "ok" {
+		t.Errorf("unexpected audit log line %+v", e)
+	}
+	if e := entries[1]; e.Result != "already banned" {
+		t.Errorf("unexpected audit log line %+v", e)
+	}
+	if e := entries[len(entries)-1]; e.Action != "unban" || e.Params["worker"] != "rig2" || e.Result != "not banned" {
+		t.Errorf("unexpected audit log line %+v", e)
+	}
+}
+
+func TestAdminSwitchPool(t *testing.T) {
+	p := newAdminTestProxy(t)
+
+	tests := []struct {
+		body     string
+		expected int
+	}{
+		{`{}`, http.StatusBadRequest},
+		{`{"url": "http://pool.example.com:8080"}`, http.StatusBadRequest},
+		{`{"url": "ws://pool example.com"}`, http.StatusBadRequest},
+		{`{"url": "ws://"}`, http.StatusBadRequest},
+		{`{"url": "pool.example.com:8080"}`, http.StatusOK},
+	}
+	for _, test := range tests {
+		if status := adminRequest(p, "POST", "/api/admin/pool", TEST_ADMIN_TOKEN, test.body); status != test.expected {
+			t.Errorf("switching pool with %s: status %d; want %d", test.body, status, test.expected)
+		}
+	}
+
+	if url := p.Config().PoolUrl; url != "ws://pool.example.com:8080" {
+		t.Errorf("pool URL %q; want ws://pool.example.com:8080", url)
+	}
+}
+
+func TestAdminChangeWallet(t *testing.T) {
+	p := newAdminTestProxy(t)
+	body := `{"wallet":"` + TEST_OTHER_WALLET + `"}`
+
+	var res map[string]string
+	w := adminResponse(p, "POST", "/api/admin/wallet", TEST_ADMIN_TOKEN, body)
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("status %d, %s", w.Code, w.Body)
+	}
+	if res["warning"] == "" {
+		t.Error("no warning about the unsaved wallet")
+	}
+	if wallet := p.Config().WalletAddress; wallet != TEST_OTHER_WALLET {
+		t.Errorf("wallet %s; want %s", wallet, TEST_OTHER_WALLET)
+	}
+
+	var saved []string
+	p.saveWallet = func(wallet string) error {
+		saved = append(saved, wallet)
+		return nil
+	}
+	body = `{"wallet":"` + TEST_WALLET + `"}`
+	w = adminResponse(p, "POST", "/api/admin/wallet", TEST_ADMIN_TOKEN, body)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "warning") {
+		t.Errorf("status %d, %s; want no warning", w.Code, w.Body)
+	}
+	if len(saved) != 1 || saved[0] != TEST_WALLET {
+		t.Errorf("saved wallets %v; want %s", saved, TEST_WALLET)
+	}
+
+	if status := adminRequest(p, "POST", "/api/admin/wallet", TEST_ADMIN_TOKEN, `{"wallet":"xel:invalid"}`); status != http.StatusBadRequest {
+		t.Errorf("invalid wallet: status %d; want %d", status, http.StatusBadRequest)
+	}
+	if len(saved) != 1 {
+		t.Errorf("invalid wallet saved: %v", saved)
+	}
+}
+
+func TestKick(t *testing.T) {
+	p, events := newTestProxy(t, newTestPool(t, 100))
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Shutdown(context.Background())
+	receive(t, events.jobs)
+
+	url := fmt.Sprintf("ws://127.0.0.1:%d/getwork/%s/1", p.Config().GetworkBindPort, TEST_WALLET)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	e := receive(t, events.connected)
+
+	// the worker is named like the ID of another miner, and only matches the given kind
+	tests := []struct {
+		kind, target string
+		kicked       int
+		err          bool
+	}{
+		{KICK_ID, "2", 0, false},
+		{KICK_ID, "rig", 0, true},
+		{BAN_IP, "127.0.0.2", 0, false},
+		{BAN_IP, "1", 0, true},
+		{"wallet", TEST_WALLET, 0, true},
+		{BAN_WORKER, "127.0.0.1", 0, false},
+		{BAN_WORKER, "1", 1, false},
+	}
+	for _, test := range tests {
+		n, err := p.Kick(test.kind, test.target)
+		if n != test.kicked || (err != nil) != test.err {
+			t.Errorf("Kick(%s, %s) = %d, %v; want %d miners", test.kind, test.target, n, err, test.kicked)
+		}
+	}
+	if e.ID != 1 {
+		t.Errorf("miner ID %d; want 1", e.ID)
+	}
+	receive(t, events.disconnected)
+}
+
+func TestAdminRebroadcast(t *testing.T) {
+	p := newAdminTestProxy(t)
+
+	if status := adminRequest(p, "POST", "/api/admin/rebroadcast", TEST_ADMIN_TOKEN, ""); status != http.StatusConflict {
+		t.Errorf("rebroadcast without a job: status %d; want %d", status, http.StatusConflict)
+	}
+
+	p.shuttingDown.Store(true)
+	if status := adminRequest(p, "POST", "/api/admin/rebroadcast", TEST_ADMIN_TOKEN, ""); status != http.StatusServiceUnavailable {
+		t.Errorf("rebroadcast during the shutdown: status %d; want %d", status, http.StatusServiceUnavailable)
+	}
+	if e := readAudit(t, p); len(e) != 2 || e[1].Result != "the proxy is shutting down" {
+		t.Errorf("unexpected audit log %+v", e)
+	}
+}
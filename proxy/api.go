@@ -0,0 +1,258 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"xelis-mining-proxy/log"
+)
+
+// HTTP JSON stats API
+
+type ApiJob struct {
+	Height     uint64    `json:"height"`
+	TopoHeight uint64    `json:"topoheight"`
+	Algorithm  string    `json:"algorithm"`
+	Difficulty uint64    `json:"difficulty"`
+	Timestamp  uint64    `json:"timestamp"`
+	IssuedAt   time.Time `json:"issued_at"`
+}
+
+type ApiPool struct {
+	Url            string    `json:"url"`
+	Protocol       string    `json:"protocol"`
+	Connected      bool      `json:"connected"`
+	ConnectedSince time.Time `json:"connected_since"`
+	LastJob        time.Time `json:"last_job"`
+	Reconnects     uint64    `json:"reconnects"`
+	PendingShares  int       `json:"pending_shares"`
+
+	Health PoolHealthInfo `json:"health"`
+}
+
+// ApiSession is the pool connection of a routed wallet
+type ApiSession struct {
+	Wallet    string `json:"wallet"`
+	Connected bool   `json:"connected"`
+	Miners    int    `json:"miners"`
+	Job       ApiJob `json:"job"`
+}
+
+type ApiStats struct {
+	Version   string             `json:"version"`
+	Uptime    uint64             `json:"uptime"`
+	Pool      ApiPool            `json:"pool"`
+	Job       ApiJob             `json:"job"`
+	Miners    int                `json:"miners"`
+	Hashrate  float64            `json:"hashrate"`
+	Hashrates map[string]float64 `json:"hashrates"`
+	Accepted  uint64             `json:"accepted"`
+	Rejected  uint64             `json:"rejected"`
+	Stale     uint64             `json:"stale"`
+	Work      float64            `json:"work"`
+	BestShare uint64             `json:"best_share"`
+	Effort    float64            `json:"effort"`
+
+	RejectReasons    map[string]uint64 `json:"reject_reasons"`
+	MissingWorkers   []string          `json:"missing_workers"`
+	ForwardingPaused bool              `json:"forwarding_paused"`
+	Sessions         []ApiSession      `json:"sessions"`
+	Split            []SplitInfo       `json:"split"`
+	LimitRefusals    map[string]uint64 `json:"limit_refusals"`
+}
+
+func newApiJob(job Job) ApiJob {
+	return ApiJob{
+		Height:     job.Height,
+		TopoHeight: job.TopoHeight,
+		Algorithm:  job.Algorithm,
+		Difficulty: job.Diff,
+		Timestamp:  job.Blob.GetTimestamp(),
+		IssuedAt:   job.IssuedAt,
+	}
+}
+
+func (p *Proxy) getApiPool() ApiPool {
+	upstream := p.upstream
+	upstream.RLock()
+	defer upstream.RUnlock()
+
+	pool := ApiPool{
+		Url:            upstream.Url,
+		Protocol:       upstream.Protocol,
+		Connected:      upstream.Connected,
+		ConnectedSince: upstream.ConnectedSince,
+		LastJob:        upstream.LastJob,
+		Reconnects:     upstream.Reconnects,
+	}
+	pool.PendingShares = p.shareTracker.GetPendingCount()
+	if upstream.Url != "" {
+		pool.Health = p.getPoolHealth(upstream.Url).Info()
+	}
+	return pool
+}
+
+// returns the pool connections of the routed wallets, sorted by wallet
+func (p *Proxy) getApiSessions() []ApiSession {
+	list := []ApiSession{}
+	for _, s := range p.listSessions() {
+		if s.isDefault() {
+			continue
+		}
+		s.RLock()
+		list = append(list, ApiSession{
+			Wallet:    s.Wallet,
+			Connected: s.client != nil,
+			Miners:    s.miners,
+			Job:       newApiJob(s.job),
+		})
+		s.RUnlock()
+	}
+	slices.SortFunc(list, func(a, b ApiSession) int {
+		return strings.Compare(a.Wallet, b.Wallet)
+	})
+	return list
+}
+
+// Stats returns the statistics of the proxy, as served by /api/stats
+func (p *Proxy) Stats() ApiStats {
+	job := p.defaultSession.getJob()
+	miners := p.Miners()
+	total := p.totalStats.Snapshot()
+
+	stats := ApiStats{
+		Version:   VERSION,
+		Uptime:    uint64(time.Since(p.startTime).Seconds()),
+		Pool:      p.getApiPool(),
+		Job:       newApiJob(job),
+		Miners:    len(miners),
+		Accepted:  total.Accepted,
+		Rejected:  total.Rejected,
+		Stale:     total.Stale,
+		Work:      total.Work,
+		BestShare: total.BestShare,
+		Effort:    p.totalStats.Effort(job.Diff),
+
+		RejectReasons:    p.getRejectReasons(),
+		MissingWorkers:   p.missingWorkers(),
+		ForwardingPaused: p.forwardingPaused.Load(),
+		Sessions:         p.getApiSessions(),
+		Split:            p.getSplitInfo(),
+		LimitRefusals:    p.limits.getRefused(),
+	}
+	stats.Hashrate = p.totalHashrate.Hashrate(MAIN_HASHRATE_WINDOW)
+	stats.Hashrates = p.totalHashrate.Hashrates()
+	return stats
+}
+
+func writeApiJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		log.Debug("api: failed to write response:", err)
+	}
+}
+
+func writeApiError(w http.ResponseWriter, status int, msg string) {
+	writeApiJSON(w, status, map[string]string{
+		"error": msg,
+	})
+}
+
+func (p *Proxy) newApiMux() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/stats", func(w http.ResponseWriter, r *http.Request) {
+		writeApiJSON(w, http.StatusOK, p.Stats())
+	})
+	mux.HandleFunc("GET /api/pool", func(w http.ResponseWriter, r *http.Request) {
+		writeApiJSON(w, http.StatusOK, p.getApiPool())
+	})
+	mux.HandleFunc("GET /api/pools", func(w http.ResponseWriter, r *http.Request) {
+		writeApiJSON(w, http.StatusOK, p.listPoolHealth())
+	})
+	mux.HandleFunc("GET /api/miners", func(w http.ResponseWriter, r *http.Request) {
+		writeApiJSON(w, http.StatusOK, p.Miners())
+	})
+	mux.HandleFunc("GET /api/miners/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeApiError(w, http.StatusBadRequest, "invalid miner id")
+			return
+		}
+
+		for _, m := range p.Miners() {
+			if m.ID == id {
+				writeApiJSON(w, http.StatusOK, m)
+				return
+			}
+		}
+		writeApiError(w, http.StatusNotFound, "miner not found")
+	})
+	mux.HandleFunc("GET /api/workers", func(w http.ResponseWriter, r *http.Request) {
+		writeApiJSON(w, http.StatusOK, p.WorkerHashrates())
+	})
+	mux.HandleFunc("GET /api/inventory", func(w http.ResponseWriter, r *http.Request) {
+		writeApiJSON(w, http.StatusOK, p.listWorkers())
+	})
+	mux.HandleFunc("GET /api/wallets", func(w http.ResponseWriter, r *http.Request) {
+		writeApiJSON(w, http.StatusOK, p.listHashrates(p.walletHashrates))
+	})
+	mux.Handle("GET /metrics", p.metrics.handler())
+	mux.HandleFunc("GET /api/jobs", func(w http.ResponseWriter, r *http.Request) {
+		job := p.defaultSession.getJob()
+
+		p.mutJobHistory.RLock()
+		history := make([]ApiJob, 0, len(p.jobHistory))
+		for _, v := range p.jobHistory {
+			history = append(history, newApiJob(v))
+		}
+		p.mutJobHistory.RUnlock()
+
+		writeApiJSON(w, http.StatusOK, map[string]any{
+			"current": newApiJob(job),
+			"history": history,
+		})
+	})
+
+	p.registerAdminApi(mux)
+
+	mux.HandleFunc("GET /ws", p.dashboard.handleWs)
+	mux.Handle("GET /", dashboardHandler())
+
+	return mux
+}
+
+// ApiHandler returns the handler of the stats API, the admin API and the dashboard, to serve them on another
+// server than the one of api_bind_address
+func (p *Proxy) ApiHandler() http.Handler {
+	p.dashboardOnce.Do(func() {
+		go p.dashboard.run()
+	})
+	return p.apiMux
+}
+
+// starts the stats API on the configured address, or stops it if the address is empty
+func (p *Proxy) listenApi() {
+	addr := p.getCfg().ApiBindAddress
+	if addr == "" {
+		p.apiListener.Close()
+		return
+	}
+
+	p.dashboardOnce.Do(func() {
+		go p.dashboard.run()
+	})
+
+	err := p.apiListener.Bind(addr)
+	if err != nil {
+		log.Err("failed to start the stats API:", err)
+		return
+	}
+	log.Info("Stats API and dashboard listening on", addr)
+}
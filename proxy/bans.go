@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"xelis-mining-proxy/log"
+	"xelis-mining-proxy/util"
+)
+
+// Banned IPs and workers, set with the admin API and saved in bans.json
+
+const (
+	BAN_IP     = "ip"
+	BAN_WORKER = "worker"
+)
+
+// Bans lists the banned IPs and workers, as saved in bans.json
+type Bans struct {
+	IPs     []string `json:"ips"`
+	Workers []string `json:"workers"`
+}
+
+// loads the bans from bans.json
+func (p *Proxy) loadBans() {
+	data, err := os.ReadFile(p.dataPath("bans.json"))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warn("failed to read bans:", err)
+		}
+		return
+	}
+
+	var bans Bans
+	err = json.Unmarshal(data, &bans)
+	if err != nil {
+		log.Warn("failed to read bans:", err)
+		return
+	}
+
+	p.mutBans.Lock()
+	defer p.mutBans.Unlock()
+
+	for _, ip := range bans.IPs {
+		p.bannedIPs[ip] = true
+	}
+	for _, w := range bans.Workers {
+		p.bannedWorkers[w] = true
+	}
+	if n := len(p.bannedIPs) + len(p.bannedWorkers); n > 0 {
+		log.Info("Loaded", n, "bans")
+	}
+}
+
+// NOTE: mutBans MUST be locked before calling this
+func (p *Proxy) saveBans() {
+	data, err := json.MarshalIndent(p.listBansLocked(), "", "\t")
+	if err != nil {
+		log.Err(err)
+		return
+	}
+
+	err = os.MkdirAll(p.dataDir, 0o750)
+	if err == nil {
+		err = util.WriteFileAtomic(p.dataPath("bans.json"), data, 0o640)
+	}
+	if err != nil {
+		log.Warn("failed to save bans:", err)
+	}
+}
+
+func (p *Proxy) banSet(kind string) map[string]bool {
+	if kind == BAN_IP {
+		return p.bannedIPs
+	}
+	return p.bannedWorkers
+}
+
+// bans an IP or a worker, and returns false if it was already banned. The banned miners are disconnected.
+func (p *Proxy) ban(kind, value string) bool {
+	p.mutBans.Lock()
+	set := p.banSet(kind)
+	if set[value] {
+		p.mutBans.Unlock()
+		return false
+	}
+	set[value] = true
+	p.saveBans()
+	p.mutBans.Unlock()
+
+	p.Kick(kind, value)
+	return true
+}
+
+// removes a ban, and returns false if it wasn't banned
+func (p *Proxy) unban(kind, value string) bool {
+	p.mutBans.Lock()
+	defer p.mutBans.Unlock()
+
+	set := p.banSet(kind)
+	if !set[value] {
+		return false
+	}
+	delete(set, value)
+	p.saveBans()
+	return true
+}
+
+func (p *Proxy) isIPBanned(ip string) bool {
+	p.mutBans.RLock()
+	defer p.mutBans.RUnlock()
+
+	return p.bannedIPs[ip]
+}
+
+func (p *Proxy) isWorkerBanned(worker string) bool {
+	p.mutBans.RLock()
+	defer p.mutBans.RUnlock()
+
+	return p.bannedWorkers[worker]
+}
+
+// NOTE: mutBans MUST be locked before calling this
+func (p *Proxy) listBansLocked() Bans {
+	bans := Bans{
+		IPs:     make([]string, 0, len(p.bannedIPs)),
+		Workers: make([]string, 0, len(p.bannedWorkers)),
+	}
+	for ip := range p.bannedIPs {
+		bans.IPs = append(bans.IPs, ip)
+	}
+	for w := range p.bannedWorkers {
+		bans.Workers = append(bans.Workers, w)
+	}
+	sort.Strings(bans.IPs)
+	sort.Strings(bans.Workers)
+	return bans
+}
+
+// returns the banned IPs and workers
+func (p *Proxy) listBans() Bans {
+	p.mutBans.RLock()
+	defer p.mutBans.RUnlock()
+
+	return p.listBansLocked()
+}
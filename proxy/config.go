@@ -0,0 +1,207 @@
+package proxy
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"xelis-mining-proxy/webhook"
+)
+
+// Config is the configuration of the proxy. The desc tag of a field documents it in the flags and in the example
+// configuration.
+type Config struct {
+	WalletAddress   string `json:"wallet" desc:"XELIS address receiving the rewards"`
+	Network         string `json:"network" desc:"Network of the wallet address: mainnet or testnet"`
+	PoolUrl         string `json:"pool_url" desc:"URL of the pool, or of the node in solo mode"`
+	PoolProtocol    string `json:"pool_protocol" desc:"Protocol of the pool: auto or getwork. auto selects getwork on the ports 8080 and 2086"`
+	GetworkBindPort uint16 `json:"getwork_bind_port" desc:"Port of the getwork server for the miners"`
+	StratumBindPort uint16 `json:"stratum_bind_port" desc:"Port of the stratum server for the miners"`
+	Debug           bool   `json:"debug" desc:"true to log at the debug level"`
+
+	TimestampDrift uint64 `json:"timestamp_drift" desc:"Maximum allowed drift (in seconds) between the timestamp of a share submitted by a getwork miner and the job it was issued for"`
+
+	JobRefreshInterval     uint64 `json:"job_refresh_interval" desc:"Interval (in seconds) after which the current job is re-issued to the miners with a fresh timestamp, 0 to disable"`
+	UpstreamTimestampDrift uint64 `json:"upstream_timestamp_drift" desc:"Maximum drift (in seconds) from the pool's template timestamp accepted by the pool"`
+
+	ApiBindAddress string `json:"api_bind_address" desc:"Address of the HTTP stats API (for example 127.0.0.1:5211), empty to disable"`
+
+	HashrateLogInterval uint64 `json:"hashrate_log_interval" desc:"Interval (in seconds) between two hashrate summaries in the logs, 0 to disable"`
+
+	LogLevel          string            `json:"log_level" desc:"Log level: error, warn, info, debug or trace. debug: true is the same as debug"`
+	LogLevels         map[string]string `json:"log_levels" desc:"Log level of each component (stratum, getwork, upstream, tracker), overriding log_level"`
+	Tui               bool              `json:"tui" desc:"true to show the live status screen in the terminal instead of plain logs"`
+	LogFormat         string            `json:"log_format" desc:"Log format: text or json"`
+	LogFile           string            `json:"log_file" desc:"Path of the log file, empty to disable"`
+	LogMaxSize        uint64            `json:"log_max_size" desc:"Size (in MB) after which the log file is rotated, 0 for no limit"`
+	LogRotateInterval uint64            `json:"log_rotate_interval" desc:"Interval (in hours) after which the log file is rotated, 0 to disable"`
+	LogMaxFiles       uint64            `json:"log_max_files" desc:"Maximum number of rotated log files kept, 0 for no limit"`
+	LogMaxAge         uint64            `json:"log_max_age" desc:"Maximum age (in days) of the rotated log files, 0 for no limit"`
+
+	JournalDir     string `json:"journal_dir" desc:"Directory of the share journal, relative to the directory of the configuration file. Empty to disable"`
+	JournalMaxAge  uint64 `json:"journal_max_age" desc:"Maximum age (in days) of the share journal files, 0 for no limit"`
+	JournalMaxSize uint64 `json:"journal_max_size" desc:"Maximum total size (in MB) of the share journal, 0 for no limit"`
+
+	Solo              bool     `json:"solo" desc:"true if pool_url is a XELIS node instead of a pool: every accepted share is then a block"`
+	MinerOfflineDelay uint64   `json:"miner_offline_delay" desc:"Delay (in seconds) after which a disconnected worker is considered offline"`
+	ExpectedWorkers   []string `json:"expected_workers" desc:"Workers expected to be connected, reported as missing when they aren't"`
+	LearnWorkers      bool     `json:"learn_workers" desc:"true to remember the workers that connected in workers.json, and report them as missing when they don't reconnect"`
+	WorkerSlowRatio   float64  `json:"worker_slow_ratio" desc:"Share rate (in percent of the 24 hours rate) below which a worker is reported as slow, 0 to disable"`
+
+	Webhooks            []webhook.Endpoint `json:"webhooks" desc:"Endpoints notified of proxy events"`
+	WebhookDebounce     uint64             `json:"webhook_debounce" desc:"Minimum interval (in seconds) between two notifications of the same event"`
+	WebhookRetries      uint64             `json:"webhook_retries" desc:"Number of retries of a failed notification"`
+	WebhookRejectRatio  float64            `json:"webhook_reject_ratio" desc:"Reject ratio (in percent) over 5 minutes above which reject_ratio is notified"`
+	WebhookHashrateDrop float64            `json:"webhook_hashrate_drop" desc:"Drop (in percent) of the 15 minutes hashrate compared to the 1 hour hashrate above which hashrate_drop is notified"`
+
+	ShutdownTimeout uint64 `json:"shutdown_timeout" desc:"Maximum time (in seconds) waited for the pool to answer the pending shares when shutting down"`
+
+	WalletRouting bool     `json:"wallet_routing" desc:"true to mine the work of each miner to the wallet it authorized with, using one pool connection per wallet"`
+	RoutedWallets []string `json:"routed_wallets" desc:"Wallets mined with their own pool connection when wallet_routing is enabled, empty to allow any valid address"`
+	UnknownWallet string   `json:"unknown_wallet" desc:"What to do with the miners authorized with another wallet when wallet_routing is enabled: default to mine to wallet, or refuse"`
+
+	AllowedIPs       []string `json:"allowed_ips" desc:"IPs or CIDR ranges (192.168.1.0/24) of the miners allowed to connect, empty to allow all"`
+	DeniedIPs        []string `json:"denied_ips" desc:"IPs or CIDR ranges of the miners refused, even if they are in allowed_ips"`
+	MaxConnections   uint64   `json:"max_connections" desc:"Maximum number of miner connections, 0 for no limit"`
+	MaxIPConnections uint64   `json:"max_ip_connections" desc:"Maximum number of miner connections from the same IP, 0 for no limit"`
+	IPConnectionRate float64  `json:"ip_connection_rate" desc:"Maximum number of connections per minute from the same IP, 0 for no limit"`
+	RequestRate      float64  `json:"request_rate" desc:"Maximum number of requests per second of a miner connection, above which it is closed, 0 for no limit"`
+	ShareRate        float64  `json:"share_rate" desc:"Maximum number of shares per second of a miner connection, above which the shares are rejected, 0 for no limit"`
+
+	WalletSplit map[string]float64 `json:"wallet_split" desc:"Percentage of the work mined to each of these wallets instead of wallet, measured by the difficulty of the accepted shares. wallet gets the rest"`
+
+	AdminTokens   []string `json:"admin_tokens" desc:"Bearer tokens allowed to use the admin API (/api/admin), empty to disable it"`
+	AdminAuditLog string   `json:"admin_audit_log" desc:"Path of the audit log of the admin actions, relative to the directory of the configuration file. Empty to only write them in the logs"`
+}
+
+// 5210: Getwork
+
+// DefaultConfig returns the default configuration
+func DefaultConfig() Config {
+	return Config{
+		Debug:           false,
+		WalletAddress:   "YOUR_WALLET_ADDRESS",
+		Network:         "mainnet",
+		PoolUrl:         "127.0.0.1:8080",
+		PoolProtocol:    "auto",
+		StratumBindPort: 5209,
+		GetworkBindPort: 5210,
+		TimestampDrift:  10,
+
+		JobRefreshInterval:     5,
+		UpstreamTimestampDrift: 60,
+		HashrateLogInterval:    60,
+
+		LogLevel:    "info",
+		LogFormat:   "text",
+		LogMaxSize:  100,
+		LogMaxFiles: 10,
+
+		JournalMaxAge:  30,
+		JournalMaxSize: 1024,
+
+		MinerOfflineDelay: 120,
+		LearnWorkers:      true,
+		WorkerSlowRatio:   50,
+
+		WebhookDebounce:     300,
+		WebhookRetries:      3,
+		WebhookRejectRatio:  10,
+		WebhookHashrateDrop: 30,
+
+		ShutdownTimeout: 10,
+
+		UnknownWallet: UNKNOWN_WALLET_DEFAULT,
+
+		AdminAuditLog: "audit.log",
+	}
+}
+
+// returns a copy of the running configuration
+func (p *Proxy) getCfg() Config {
+	p.mutCfg.RLock()
+	defer p.mutCfg.RUnlock()
+
+	return p.cfg
+}
+
+// Config returns a copy of the running configuration
+func (p *Proxy) Config() Config {
+	return p.getCfg()
+}
+
+// returns the pool URL with a websocket scheme if it has no scheme
+func getworkUrl(url string) string {
+	// other schemes are kept, to be reported by Validate
+	if !strings.Contains(url, "://") {
+		return "ws://" + url
+	}
+	return url
+}
+
+// Normalize resolves the automatic pool protocol from the port of the pool URL, and adds the websocket scheme to
+// getwork pool URLs. It returns true if the protocol was automatically selected.
+func (c *Config) Normalize() bool {
+	c.PoolProtocol = strings.ToLower(c.PoolProtocol)
+
+	auto := c.PoolProtocol == "auto"
+	if auto {
+		c.PoolProtocol = "stratum"
+		splUrl := strings.Split(c.PoolUrl, ":")
+		if len(splUrl) > 2 {
+			splUrl = splUrl[1:]
+		}
+
+		if len(splUrl) > 1 {
+			port := splUrl[1]
+
+			if port == "8080" || port == "2086" {
+				c.PoolProtocol = "getwork"
+			}
+		}
+	}
+
+	if c.PoolProtocol == "getwork" {
+		c.PoolUrl = getworkUrl(c.PoolUrl)
+	}
+	return auto
+}
+
+// FieldName returns the JSON name of a struct field of Config, or "-" if it isn't encoded
+func FieldName(sf reflect.StructField) string {
+	if !sf.IsExported() {
+		return "-"
+	}
+	name := strings.Split(sf.Tag.Get("json"), ",")[0]
+	if name == "" {
+		name = strings.ToLower(sf.Name)
+	}
+	return name
+}
+
+// Diff returns the JSON names of the fields that differ between two configurations, with their old and new
+// values. The secrets aren't included in the values.
+func Diff(old, new Config) ([]string, []string) {
+	var fields, changes []string
+
+	ov, nv := reflect.ValueOf(old), reflect.ValueOf(new)
+	t := ov.Type()
+	for i := 0; i < t.NumField(); i++ {
+		a, b := ov.Field(i).Interface(), nv.Field(i).Interface()
+		if reflect.DeepEqual(a, b) {
+			continue
+		}
+
+		name := FieldName(t.Field(i))
+		fields = append(fields, name)
+
+		// don't log the secrets
+		switch name {
+		case "webhooks":
+			a, b = len(old.Webhooks), len(new.Webhooks)
+		case "admin_tokens":
+			a, b = len(old.AdminTokens), len(new.AdminTokens)
+		}
+		changes = append(changes, fmt.Sprintf("%s: %v -> %v", name, a, b))
+	}
+	return fields, changes
+}
@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"xelis-mining-proxy/log"
+	"xelis-mining-proxy/util"
+
+	"github.com/xelis-project/xelis-go-sdk/address"
+)
+
+// Validation of the configuration, at startup, on reload and with --check-config
+
+// minimum length of the admin API tokens
+const MIN_ADMIN_TOKEN_LENGTH = 16
+
+// ValidateAddress checks that the address is a valid XELIS address of the network
+func ValidateAddress(addr string, network string) error {
+	a, err := address.NewAddressFromString(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	if a.IsMainnet() != (network == "mainnet") {
+		return fmt.Errorf("address %q is not a %s address", addr, network)
+	}
+	return nil
+}
+
+// returns the port of a host:port address
+func addrPort(addr string) (uint16, error) {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return 0, err
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid port %q", port)
+	}
+	return uint16(p), nil
+}
+
+// Validate checks a normalized configuration, reporting every problem with the name of its field
+func (c Config) Validate() error {
+	var errs []error
+	fail := func(field string, format string, a ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, a...)))
+	}
+
+	switch c.Network {
+	case "mainnet", "testnet":
+		if c.WalletAddress == "" || c.WalletAddress == "YOUR_WALLET_ADDRESS" {
+			fail("wallet", "missing wallet address")
+		} else if err := ValidateAddress(c.WalletAddress, c.Network); err != nil {
+			fail("wallet", "%v", err)
+		}
+	default:
+		fail("network", "unknown network %q, possible values: mainnet, testnet", c.Network)
+	}
+
+	switch c.PoolProtocol {
+	case "getwork":
+		u, err := url.Parse(c.PoolUrl)
+		if err != nil {
+			fail("pool_url", "%v", err)
+		} else if u.Scheme != "ws" && u.Scheme != "wss" {
+			fail("pool_url", "unsupported scheme %q, expected ws or wss", u.Scheme)
+		} else if u.Host == "" {
+			fail("pool_url", "missing host in %q", c.PoolUrl)
+		}
+	case "stratum":
+		fail("pool_protocol", "stratum pools are not supported yet")
+	default:
+		fail("pool_protocol", "unknown protocol %q, possible values: auto, getwork, stratum", c.PoolProtocol)
+	}
+
+	if c.StratumBindPort == 0 {
+		fail("stratum_bind_port", "missing port")
+	}
+	if c.GetworkBindPort == 0 {
+		fail("getwork_bind_port", "missing port")
+	}
+	if c.GetworkBindPort == c.StratumBindPort {
+		fail("getwork_bind_port", "same port as stratum_bind_port")
+	}
+	if c.ApiBindAddress != "" {
+		port, err := addrPort(c.ApiBindAddress)
+		if err != nil {
+			fail("api_bind_address", "%v", err)
+		} else if port == c.StratumBindPort || port == c.GetworkBindPort {
+			fail("api_bind_address", "port %d is already used by the stratum or getwork server", port)
+		}
+	}
+
+	if _, err := log.ParseLevel(c.LogLevel); c.LogLevel != "" && err != nil {
+		fail("log_level", "%v", err)
+	}
+	for component, level := range c.LogLevels {
+		if _, err := log.ParseLevel(level); err != nil {
+			fail("log_levels."+component, "%v", err)
+		}
+	}
+	if c.LogFormat != "" && c.LogFormat != "text" && c.LogFormat != "json" {
+		fail("log_format", "unknown format %q, possible values: text, json", c.LogFormat)
+	}
+
+	for i, e := range c.Webhooks {
+		field := fmt.Sprintf("webhooks[%d]", i)
+		u, err := url.Parse(e.Url)
+		if err != nil {
+			fail(field+".url", "%v", err)
+		} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail(field+".url", "invalid URL %q, expected http or https", e.Url)
+		}
+		for _, ev := range e.Events {
+			if !slices.Contains(webhookEvents, ev) {
+				fail(field+".events", "unknown event %q", ev)
+			}
+		}
+	}
+
+	for i, wallet := range c.RoutedWallets {
+		if err := ValidateAddress(wallet, c.Network); err != nil {
+			fail(fmt.Sprintf("routed_wallets[%d]", i), "%v", err)
+		}
+	}
+	if c.UnknownWallet != UNKNOWN_WALLET_DEFAULT && c.UnknownWallet != UNKNOWN_WALLET_REFUSE {
+		fail("unknown_wallet", "unknown value %q, possible values: %s, %s", c.UnknownWallet, UNKNOWN_WALLET_DEFAULT,
+			UNKNOWN_WALLET_REFUSE)
+	}
+
+	if _, err := util.ParseIPSet(c.AllowedIPs); err != nil {
+		fail("allowed_ips", "%v", err)
+	}
+	if _, err := util.ParseIPSet(c.DeniedIPs); err != nil {
+		fail("denied_ips", "%v", err)
+	}
+	if c.IPConnectionRate < 0 {
+		fail("ip_connection_rate", "negative rate")
+	}
+	if c.RequestRate < 0 {
+		fail("request_rate", "negative rate")
+	}
+	if c.ShareRate < 0 {
+		fail("share_rate", "negative rate")
+	}
+
+	splitTotal := 0.0
+	for wallet, percent := range c.WalletSplit {
+		field := "wallet_split." + wallet
+		if err := ValidateAddress(wallet, c.Network); err != nil {
+			fail(field, "%v", err)
+		} else if wallet == c.WalletAddress {
+			fail(field, "same address as wallet")
+		}
+		if percent <= 0 || percent > 100 {
+			fail(field, "percentage %v out of range, expected more than 0 and at most 100", percent)
+		}
+		splitTotal += percent
+	}
+	if splitTotal > 100 {
+		fail("wallet_split", "the percentages add up to %v, more than 100", splitTotal)
+	}
+
+	for i, token := range c.AdminTokens {
+		if len(token) < MIN_ADMIN_TOKEN_LENGTH {
+			fail(fmt.Sprintf("admin_tokens[%d]", i), "too short, use at least %d characters", MIN_ADMIN_TOKEN_LENGTH)
+		}
+	}
+
+	return errors.Join(errs...)
+}
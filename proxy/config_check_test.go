@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"strings"
+	"testing"
+	"xelis-mining-proxy/webhook"
+)
+
+const TEST_TESTNET_WALLET = "xet:6eadzwf5xdacts6fs4y3csmnsmy4mcxewqt3xyygwfx0hm0tm32sqxdy9zk"
+const TEST_OTHER_WALLET = "xel:vs3mfyywt0fjys0rgslue7mm4wr23xdgejsjk0ld7f2kxng4d4nqqnkdufz"
+const TEST_THIRD_WALLET = "xel:quyqjzstpsxsurcszyfpx9q4zct3sxg6rvwp68slyqsjygeyy5nqqze4krd"
+
+func TestValidateAddress(t *testing.T) {
+	tests := []struct {
+		addr    string
+		network string
+		valid   bool
+	}{
+		{TEST_WALLET, "mainnet", true},
+		{TEST_OTHER_WALLET, "mainnet", true},
+		{TEST_THIRD_WALLET, "mainnet", true},
+		{TEST_TESTNET_WALLET, "testnet", true},
+		{TEST_WALLET, "testnet", false},
+		{TEST_TESTNET_WALLET, "mainnet", false},
+		{TEST_WALLET[:len(TEST_WALLET)-1], "mainnet", false},
+		{TEST_WALLET[:len(TEST_WALLET)-1] + "q", "mainnet", false},
+		{"YOUR_WALLET_ADDRESS", "mainnet", false},
+		{"", "mainnet", false},
+	}
+
+	for _, test := range tests {
+		err := ValidateAddress(test.addr, test.network)
+		if (err == nil) != test.valid {
+			t.Errorf("ValidateAddress(%q, %q) = %v; want valid %v", test.addr, test.network, err, test.valid)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	base := DefaultConfig()
+	base.WalletAddress = TEST_WALLET
+	base.Normalize()
+	if err := base.Validate(); err != nil {
+		t.Fatalf("default configuration with a wallet is invalid: %v", err)
+	}
+
+	tests := []struct {
+		field  string // expected field of the error, empty for a valid configuration
+		modify func(c *Config)
+	}{
+		{"wallet", func(c *Config) { c.WalletAddress = "YOUR_WALLET_ADDRESS" }},
+		{"wallet", func(c *Config) { c.WalletAddress = "" }},
+		{"wallet", func(c *Config) { c.WalletAddress = TEST_TESTNET_WALLET }},
+		{"", func(c *Config) { c.Network, c.WalletAddress = "testnet", TEST_TESTNET_WALLET }},
+		{"network", func(c *Config) { c.Network = "devnet" }},
+		{"pool_url", func(c *Config) { c.PoolUrl = "http://pool.example.com:8080" }},
+		{"pool_url", func(c *Config) { c.PoolUrl = "ws://" }},
+		{"pool_url", func(c *Config) { c.PoolUrl = "ws://pool example.com" }},
+		{"", func(c *Config) { c.PoolUrl = "wss://pool.example.com/path" }},
+		{"pool_protocol", func(c *Config) { c.PoolProtocol = "stratum" }},
+		{"pool_protocol", func(c *Config) { c.PoolProtocol = "http" }},
+		{"stratum_bind_port", func(c *Config) { c.StratumBindPort = 0 }},
+		{"getwork_bind_port", func(c *Config) { c.GetworkBindPort = c.StratumBindPort }},
+		{"api_bind_address", func(c *Config) { c.ApiBindAddress = "127.0.0.1" }},
+		{"api_bind_address", func(c *Config) { c.ApiBindAddress = "127.0.0.1:5209" }},
+		{"", func(c *Config) { c.ApiBindAddress = "127.0.0.1:5211" }},
+		{"log_level", func(c *Config) { c.LogLevel = "verbose" }},
+		{"log_levels.stratum", func(c *Config) { c.LogLevels = map[string]string{"stratum": "loud"} }},
+		{"log_format", func(c *Config) { c.LogFormat = "xml" }},
+		{"webhooks[0].url", func(c *Config) { c.Webhooks = []webhook.Endpoint{{Url: "ftp://example.com"}} }},
+		{"webhooks[0].events", func(c *Config) {
+			c.Webhooks = []webhook.Endpoint{{Url: "https://example.com", Events: []string{"unknown"}}}
+		}},
+		{"routed_wallets[1]", func(c *Config) { c.RoutedWallets = []string{TEST_OTHER_WALLET, TEST_TESTNET_WALLET} }},
+		{"unknown_wallet", func(c *Config) { c.UnknownWallet = "drop" }},
+		{"allowed_ips", func(c *Config) { c.AllowedIPs = []string{"10.0.0.0/33"} }},
+		{"denied_ips", func(c *Config) { c.DeniedIPs = []string{"example.com"} }},
+		{"", func(c *Config) { c.AllowedIPs, c.DeniedIPs = []string{"10.0.0.0/8", "::1"}, []string{"fd00::/8"} }},
+		{"ip_connection_rate", func(c *Config) { c.IPConnectionRate = -1 }},
+		{"request_rate", func(c *Config) { c.RequestRate = -1 }},
+		{"share_rate", func(c *Config) { c.ShareRate = -1 }},
+		{"wallet_split." + TEST_WALLET, func(c *Config) { c.WalletSplit = map[string]float64{TEST_WALLET: 10} }},
+		{"wallet_split." + TEST_OTHER_WALLET, func(c *Config) { c.WalletSplit = map[string]float64{TEST_OTHER_WALLET: 0} }},
+		{"wallet_split", func(c *Config) {
+			c.WalletSplit = map[string]float64{TEST_OTHER_WALLET: 60, TEST_THIRD_WALLET: 50}
+		}},
+		{"", func(c *Config) { c.WalletSplit = map[string]float64{TEST_OTHER_WALLET: 100} }},
+		{"admin_tokens[1]", func(c *Config) { c.AdminTokens = []string{TEST_ADMIN_TOKEN, "short"} }},
+	}
+
+	for _, test := range tests {
+		c := base
+		test.modify(&c)
+		err := c.Validate()
+
+		if test.field == "" {
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			continue
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), test.field+": ") {
+			t.Errorf("got error %v; want an error of %s", err, test.field)
+		}
+	}
+}
+
+func TestValidateReportsEveryField(t *testing.T) {
+	c := DefaultConfig()
+	c.Network = "devnet"
+	c.PoolProtocol = "http"
+	c.StratumBindPort = 0
+	c.LogFormat = "xml"
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, field := range []string{"network", "pool_protocol", "stratum_bind_port", "log_format"} {
+		if !strings.Contains(err.Error(), field+": ") {
+			t.Errorf("error %q doesn't report %s", err, field)
+		}
+	}
+}
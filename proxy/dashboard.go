@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"sync"
+	"time"
+	"xelis-mining-proxy/log"
+
+	"github.com/gorilla/websocket"
+)
+
+// Web dashboard, updated over a websocket
+
+//go:embed web
+var webAssets embed.FS
+
+// number of log lines kept for the dashboard log tail
+const DASHBOARD_LOG_LINES = 200
+
+// interval between two dashboard updates
+const DASHBOARD_INTERVAL = 2 * time.Second
+
+type DashboardUpdate struct {
+	Time   time.Time   `json:"time"`
+	Stats  ApiStats    `json:"stats"`
+	Miners []MinerInfo `json:"miners"`
+	Logs   []string    `json:"logs"`
+}
+
+type dashboardClient struct {
+	conn *websocket.Conn
+
+	sync.Mutex
+}
+
+type DashboardHub struct {
+	proxy *Proxy
+
+	clients map[*dashboardClient]bool
+	logs    []string // last log lines
+	newLogs []string // log lines not sent to the clients yet
+
+	sync.Mutex
+}
+
+func newDashboardHub(p *Proxy) *DashboardHub {
+	return &DashboardHub{
+		proxy:   p,
+		clients: make(map[*dashboardClient]bool),
+	}
+}
+
+func (h *DashboardHub) addLog(line string) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.logs = append(h.logs, line)
+	if len(h.logs) > DASHBOARD_LOG_LINES {
+		h.logs = h.logs[1:]
+	}
+	h.newLogs = append(h.newLogs, line)
+	if len(h.newLogs) > DASHBOARD_LOG_LINES {
+		h.newLogs = h.newLogs[1:]
+	}
+}
+
+// sends the updates to the clients, until the proxy is shut down
+func (h *DashboardHub) run() {
+	p := h.proxy
+	defer log.AddListener(h.addLog)()
+
+	for p.sleep(DASHBOARD_INTERVAL) {
+		update := DashboardUpdate{
+			Time:   time.Now(),
+			Stats:  p.Stats(),
+			Miners: p.Miners(),
+		}
+
+		h.Lock()
+		update.Logs = h.newLogs
+		h.newLogs = nil
+		clients := make([]*dashboardClient, 0, len(h.clients))
+		for c := range h.clients {
+			clients = append(clients, c)
+		}
+		h.Unlock()
+
+		for _, c := range clients {
+			go h.send(c, update)
+		}
+	}
+}
+
+func (h *DashboardHub) send(c *dashboardClient, update DashboardUpdate) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(DASHBOARD_INTERVAL))
+	err := c.conn.WriteJSON(update)
+	if err != nil {
+		h.remove(c)
+	}
+}
+
+func (h *DashboardHub) remove(c *dashboardClient) {
+	h.Lock()
+	delete(h.clients, c)
+	h.Unlock()
+
+	c.conn.Close()
+}
+
+func (h *DashboardHub) handleWs(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Debug("dashboard upgrade:", err)
+		return
+	}
+
+	c := &dashboardClient{conn: conn}
+
+	// the first update contains the whole log tail
+	h.Lock()
+	update := DashboardUpdate{
+		Time: time.Now(),
+		Logs: append([]string{}, h.logs...),
+	}
+	h.clients[c] = true
+	h.Unlock()
+
+	update.Stats = h.proxy.Stats()
+	update.Miners = h.proxy.Miners()
+	h.send(c, update)
+
+	// wait for the client to close the connection
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			h.remove(c)
+			return
+		}
+	}
+}
+
+func dashboardHandler() http.Handler {
+	sub, err := fs.Sub(webAssets, "web")
+	if err != nil {
+		log.Fatal(err)
+	}
+	return http.FileServerFS(sub)
+}
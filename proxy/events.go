@@ -0,0 +1,267 @@
+package proxy
+
+import (
+	"time"
+	"xelis-mining-proxy/log"
+	"xelis-mining-proxy/webhook"
+)
+
+// Proxy events: typed callbacks given in the options, and webhook notifications
+
+// Events are the callbacks of the proxy events. They are called in order by a single goroutine, so a callback can
+// use the methods of the proxy but delays the next events until it returns. Events are dropped when
+// EVENT_QUEUE_SIZE events are already waiting. A nil callback is ignored.
+type Events struct {
+	OnMinerConnected    func(MinerEvent) // a getwork miner connected, or a stratum miner authorized
+	OnMinerDisconnected func(MinerEvent)
+
+	OnShare      func(ShareEvent) // a share was answered by the pool, or refused by the proxy
+	OnBlockFound func(ShareEvent) // a share was accepted in solo mode
+	OnJob        func(JobEvent)   // a new job was received from the pool
+
+	OnUpstreamConnected    func(UpstreamEvent)
+	OnUpstreamDisconnected func(UpstreamEvent)
+
+	OnWorkerOffline func(WorkerEvent) // a worker didn't reconnect within miner_offline_delay
+	OnWorkerOnline  func(WorkerEvent) // an offline worker came back
+}
+
+// MinerEvent describes a downstream miner connection
+type MinerEvent struct {
+	ID       uint64
+	Protocol string
+	IP       string
+	Wallet   string
+	Worker   string
+}
+
+// ShareEvent describes the result of a share
+type ShareEvent struct {
+	Protocol   string
+	IP         string
+	Worker     string // worker name, or IP of the miner if it has no name
+	Wallet     string
+	Height     uint64
+	Difficulty uint64 // difficulty assigned to the miner
+	Accepted   bool
+	Reason     string        // reason of the rejection
+	RoundTrip  time.Duration // zero for the shares refused by the proxy
+}
+
+// JobEvent describes a job received from the pool
+type JobEvent struct {
+	Wallet     string // wallet the job is mined to
+	Height     uint64
+	TopoHeight uint64
+	Difficulty uint64
+	Algorithm  string
+}
+
+// UpstreamEvent describes the connection to the pool
+type UpstreamEvent struct {
+	Url string
+}
+
+// WorkerEvent describes a worker of the inventory
+type WorkerEvent struct {
+	Name     string
+	LastSeen time.Time
+}
+
+// maximum number of events waiting for their callback
+const EVENT_QUEUE_SIZE = 1024
+
+// queues the call of a callback with the event, unless the callback is nil
+func emit[T any](p *Proxy, callback func(T), e T) {
+	if callback == nil {
+		return
+	}
+	select {
+	case p.eventQueue <- func() { callback(e) }:
+	default:
+		log.Debug("event queue full, dropping an event")
+	}
+}
+
+// calls the callbacks of the queued events, until the proxy is shut down
+func (p *Proxy) dispatchEvents() {
+	for {
+		select {
+		case f := <-p.eventQueue:
+			f()
+		case <-p.eventsDone:
+			for {
+				select {
+				case f := <-p.eventQueue:
+					f()
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (p *Proxy) shareEvent(e ShareEvent) {
+	emit(p, p.events.OnShare, e)
+}
+
+func (p *Proxy) jobEvent(s *Session, job Job) {
+	emit(p, p.events.OnJob, JobEvent{
+		Wallet:     s.wallet(p.getCfg()),
+		Height:     job.Height,
+		TopoHeight: job.TopoHeight,
+		Difficulty: job.Diff,
+		Algorithm:  job.Algorithm,
+	})
+}
+
+const (
+	EVENT_UPSTREAM_DISCONNECTED = "upstream_disconnected"
+	EVENT_UPSTREAM_RECONNECTED  = "upstream_reconnected"
+	EVENT_POOL_SWITCHED         = "pool_switched"
+	EVENT_MINER_OFFLINE         = "miner_offline"
+	EVENT_MINER_ONLINE          = "miner_online"
+	EVENT_REJECT_RATIO          = "reject_ratio"
+	EVENT_HASHRATE_DROP         = "hashrate_drop"
+	EVENT_BLOCK_FOUND           = "block_found"
+)
+
+var webhookEvents = []string{
+	EVENT_UPSTREAM_DISCONNECTED, EVENT_UPSTREAM_RECONNECTED, EVENT_POOL_SWITCHED, EVENT_MINER_OFFLINE,
+	EVENT_MINER_ONLINE, EVENT_REJECT_RATIO, EVENT_HASHRATE_DROP, EVENT_BLOCK_FOUND,
+}
+
+// window over which the reject ratio is computed
+const REJECT_RATIO_WINDOW = 5 * time.Minute
+
+// minimum number of shares in the window before the reject ratio is notified
+const REJECT_RATIO_MIN_SHARES = 10
+
+func (p *Proxy) startWebhooks() {
+	p.configureWebhooks()
+
+	go p.eventMonitor()
+}
+
+// creates the notifier of the configured webhooks
+func (p *Proxy) configureWebhooks() {
+	cfg := p.getCfg()
+
+	p.notifier.Store(webhook.New(cfg.Webhooks, time.Duration(cfg.WebhookDebounce)*time.Second, int(cfg.WebhookRetries)))
+	if len(cfg.Webhooks) > 0 {
+		log.Info("Sending events to", len(cfg.Webhooks), "webhooks")
+	}
+}
+
+// sends an event to the webhooks that subscribed to it, see webhook.Notifier.Notify
+func (p *Proxy) notify(event, key string, data map[string]any) bool {
+	n := p.notifier.Load()
+	if n == nil {
+		return false
+	}
+	return n.Notify(event, key, data)
+}
+
+func (p *Proxy) notifyUpstreamDisconnected(url string) {
+	emit(p, p.events.OnUpstreamDisconnected, UpstreamEvent{url})
+
+	p.mutUpstreamDown.Lock()
+	defer p.mutUpstreamDown.Unlock()
+
+	if p.notify(EVENT_UPSTREAM_DISCONNECTED, url, map[string]any{"url": url}) {
+		p.upstreamDownNotified = true
+	}
+}
+
+func (p *Proxy) notifyUpstreamConnected(url string) {
+	emit(p, p.events.OnUpstreamConnected, UpstreamEvent{url})
+
+	p.mutUpstreamDown.Lock()
+	defer p.mutUpstreamDown.Unlock()
+
+	if p.upstreamDownNotified {
+		p.upstreamDownNotified = false
+		p.notify(EVENT_UPSTREAM_RECONNECTED, url, map[string]any{"url": url})
+	}
+}
+
+func (p *Proxy) notifyPoolSwitched(from, to string) {
+	p.notify(EVENT_POOL_SWITCHED, to, map[string]any{"from": from, "to": to})
+}
+
+func (p *Proxy) notifyBlockFound(ps *PendingShare, e ShareEvent) {
+	log.Infof("Block found by %s at height %d", ps.Worker, ps.Height)
+	emit(p, p.events.OnBlockFound, e)
+	p.notify(EVENT_BLOCK_FOUND, ps.ID, map[string]any{
+		"height":     ps.Height,
+		"worker":     ps.Worker,
+		"wallet":     ps.Wallet,
+		"difficulty": ps.Difficulty,
+	})
+}
+
+func (p *Proxy) notifyMinerOffline(w *WorkerState) bool {
+	emit(p, p.events.OnWorkerOffline, WorkerEvent{w.Name, w.lastSeen()})
+	return p.notify(EVENT_MINER_OFFLINE, w.Name, map[string]any{
+		"worker":    w.Name,
+		"last_seen": w.lastSeen(),
+	})
+}
+
+func (p *Proxy) notifyMinerOnline(w *WorkerState) {
+	emit(p, p.events.OnWorkerOnline, WorkerEvent{w.Name, w.lastSeen()})
+	p.notify(EVENT_MINER_ONLINE, w.Name, map[string]any{
+		"worker":  w.Name,
+		"offline": time.Since(w.DisconnectedAt).Seconds(),
+	})
+}
+
+// periodically checks the reject ratio and the hashrate
+func (p *Proxy) eventMonitor() {
+	// share counters of the last minutes, oldest first
+	var history []ShareCounters
+
+	for p.sleep(time.Minute) {
+		cfg := p.getCfg()
+
+		history = append(history, p.totalStats.Snapshot())
+		if len(history) > int(REJECT_RATIO_WINDOW/time.Minute)+1 {
+			history = history[1:]
+		}
+
+		first, last := history[0], history[len(history)-1]
+		accepted := last.Accepted - first.Accepted
+		rejected := last.Rejected - first.Rejected + last.Stale - first.Stale
+		if total := accepted + rejected; total >= REJECT_RATIO_MIN_SHARES {
+			ratio := float64(rejected) / float64(total) * 100
+			if ratio > cfg.WebhookRejectRatio {
+				p.notify(EVENT_REJECT_RATIO, "", map[string]any{
+					"ratio":     ratio,
+					"threshold": cfg.WebhookRejectRatio,
+					"accepted":  accepted,
+					"rejected":  rejected,
+					"window":    REJECT_RATIO_WINDOW.Seconds(),
+				})
+			}
+		}
+
+		// the 1 hour hashrate is only meaningful after an hour
+		if time.Since(p.startTime) < time.Hour {
+			continue
+		}
+		recent := p.totalHashrate.Hashrate(MAIN_HASHRATE_WINDOW)
+		hourly := p.totalHashrate.Hashrate(time.Hour)
+		if hourly > 0 {
+			drop := (1 - recent/hourly) * 100
+			if drop > cfg.WebhookHashrateDrop {
+				p.notify(EVENT_HASHRATE_DROP, "", map[string]any{
+					"drop":         drop,
+					"threshold":    cfg.WebhookHashrateDrop,
+					"hashrate_15m": recent,
+					"hashrate_1h":  hourly,
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package proxy
+
+import (
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"time"
+	"xelis-mining-proxy/getwork"
+	"xelis-mining-proxy/journal"
+	"xelis-mining-proxy/log"
+	"xelis-mining-proxy/stratum"
+	"xelis-mining-proxy/util"
+)
+
+// Getwork client
+
+var upstreamLog = log.Component("upstream")
+
+// Share represents a share to be sent to the pool
+type Share struct {
+	ID      string // Unique identifier: hex(extra_nonce + nonce)
+	Encoded string // minerWork hex encoded string
+}
+
+// SwitchPool closes the pool connection, the next connection uses the new pool URL. The URL is checked like the
+// pool_url of the configuration, and an error is returned if it is invalid.
+func (p *Proxy) SwitchPool(url string) error {
+	p.mutCfg.Lock()
+	c := p.cfg
+	c.PoolUrl = getworkUrl(url)
+	if err := c.Validate(); err != nil {
+		p.mutCfg.Unlock()
+		return err
+	}
+	p.cfg = c
+	p.mutCfg.Unlock()
+
+	upstreamLog.Info("Switching to pool", c.PoolUrl)
+	p.reconnectPool()
+	return nil
+}
+
+// closes the pool connections, so the next connections use the running configuration
+func (p *Proxy) reconnectPool() {
+	for _, s := range p.listSessions() {
+		s.disconnect()
+	}
+}
+
+// connects to the pool and forwards the jobs and shares of the session, reconnecting until the session is closed
+func (s *Session) run() {
+	p := s.proxy
+	for !s.isClosed() {
+		cfg := p.getCfg()
+		wallet := s.wallet(cfg)
+		if s.isDefault() {
+			upstreamLog.Info("Starting a new connection to the pool")
+			p.upstream.setConnecting(cfg.PoolUrl)
+		} else {
+			upstreamLog.Info("Starting a new connection to the pool for wallet", wallet)
+		}
+
+		s.pending = make(chan string, 100) // Buffer for pending shares
+
+		clGw, err := getwork.NewGetwork(cfg.PoolUrl+"/getwork", wallet, "xelis-mining-proxy v"+VERSION)
+		if err != nil {
+			upstreamLog.Err(err)
+			time.Sleep(time.Second)
+			continue
+		}
+		s.setClient(clGw)
+
+		if s.isDefault() {
+			p.upstream.setConnected()
+		}
+
+		go s.recvShares(clGw)
+		go s.readAccept(clGw)
+		go s.readReject(clGw)
+		go readErrGw(clGw)
+
+		s.readJobs(clGw)
+
+		s.setClient(nil)
+		if s.isDefault() {
+			p.upstream.setDisconnected()
+		}
+
+		upstreamLog.Debug("pool connection closed, starting a new one")
+
+		time.Sleep(time.Second)
+	}
+	upstreamLog.Info("Closed the pool connection of wallet", s.Wallet)
+}
+
+func (s *Session) recvShares(clGw *getwork.Getwork) {
+	p := s.proxy
+	upstreamLog.Debug("recvShares started")
+	for {
+		var share Share
+		select {
+		case share = <-s.shares:
+		case <-clGw.Done():
+			return
+		}
+
+		upstreamLog.Debug("Share found, submitting to pool")
+
+		upstreamLog.Debugf("Share ID: %s, Encoded: %s", share.ID, share.Encoded)
+
+		if p.forwardingPaused.Load() {
+			if pending := p.shareTracker.GetPendingShare(share.ID); pending != nil {
+				pending.ResponseChan <- ShareResult{
+					Accepted: false,
+					Error: &stratum.Error{
+						Code:    -1,
+						Message: "share forwarding is paused",
+					},
+					Reason: "forwarding_paused",
+				}
+			}
+			continue
+		}
+
+		// Add to FIFO queue BEFORE submitting to pool
+		s.pending <- share.ID
+
+		err := clGw.SubmitBlock(share.Encoded)
+		if err != nil {
+			upstreamLog.Err("failed to submit share to pool:", err)
+
+			// On submit error, remove from queue and send rejection
+			<-s.pending // Remove from queue
+			if pending := p.shareTracker.GetPendingShare(share.ID); pending != nil {
+				pending.ResponseChan <- ShareResult{
+					Accepted: false,
+					Error: &stratum.Error{
+						Code:    -1,
+						Message: "failed to submit to pool",
+					},
+					Reason: "submit_failed",
+				}
+			}
+
+			clGw.Close()
+			return
+		}
+
+		if pending := p.shareTracker.GetPendingShare(share.ID); pending != nil {
+			p.journalShare(journal.EventForwarded, pending, "")
+		}
+	}
+}
+func (s *Session) readJobs(clGw *getwork.Getwork) {
+	p := s.proxy
+	for {
+		job, ok := <-clGw.Job
+		if !ok {
+			return
+		}
+
+		tmpl, err := hex.DecodeString(job.Template)
+		if err != nil {
+			upstreamLog.Err(err)
+			clGw.Close()
+			return
+		}
+
+		diff, err := strconv.ParseUint(job.Difficulty, 10, 64)
+		if err != nil {
+			upstreamLog.Err(err)
+			clGw.Close()
+			return
+		}
+
+		if len(tmpl) != util.BLOCKMINER_LENGTH {
+			upstreamLog.Errf("template %x length is invalid", tmpl)
+			clGw.Close()
+			return
+		}
+
+		upstreamLog.Debug("new job from GetWork")
+
+		bm := util.BlockMiner(tmpl)
+
+		newJob := Job{
+			Blob:              bm,
+			Diff:              diff,
+			Target:            util.GetTargetBytes(diff),
+			Algorithm:         job.Algorithm,
+			Height:            job.Height,
+			TopoHeight:        job.TopoHeight,
+			UpstreamTimestamp: bm.GetTimestamp(),
+			IssuedAt:          time.Now(),
+		}
+
+		prevJob := s.setJob(newJob)
+		p.jobEvent(s, newJob)
+		if !s.isDefault() {
+			upstreamLog.Height(job.Height).Infof("new job with difficulty %d for wallet %s", diff, s.Wallet)
+			go p.broadcastJob(s, newJob, nil)
+			continue
+		}
+
+		p.newStatsRound(prevJob, newJob.Height)
+		p.upstream.setLastJob(newJob.IssuedAt)
+		p.addJobHistory(newJob)
+		health := p.upstream.health()
+		health.addJob(newJob.Height, newJob.IssuedAt)
+
+		upstreamLog.Height(job.Height).Infof("new job with difficulty %d for algorithm %s", diff, job.Algorithm)
+		upstreamLog.Debugf("new job: diff %d, blob %x", diff, tmpl)
+
+		upstreamLog.Debugf("blob public key %x", util.BlockMiner(tmpl).GetPublickey())
+
+		go p.broadcastJob(s, newJob, health)
+	}
+}
+
+// sends a new job to the miners of the session, measuring the time until the last miner is notified. health is
+// nil for the sessions of the routed wallets.
+func (p *Proxy) broadcastJob(s *Session, job Job, health *PoolHealth) {
+	if p.shuttingDown.Load() {
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		p.sendJobToWebsocket(s, job)
+	}()
+	go func() {
+		defer wg.Done()
+		p.sendStratumJobs(s, job, true)
+	}()
+	wg.Wait()
+
+	if health != nil {
+		health.addBroadcast(time.Since(job.IssuedAt))
+	}
+}
+
+// logs the errors of the pool connection
+func readErrGw(clGw *getwork.Getwork) {
+	for {
+		err, ok := <-clGw.Err
+		if !ok {
+			return
+		}
+
+		upstreamLog.Warn("pool connection error:", err)
+	}
+}
+
+func (s *Session) readAccept(clGw *getwork.Getwork) {
+	for {
+		accepted, ok := <-clGw.AcceptedBlock
+		if !ok {
+			return
+		}
+
+		upstreamLog.Debug("share accepted:", accepted)
+
+		// Get the next share ID from FIFO queue
+		shareID, ok := <-s.pending
+		if !ok {
+			upstreamLog.Warn("pending share queue closed")
+			return
+		}
+
+		// Send acceptance to the waiting miner
+		if pending := s.proxy.shareTracker.GetPendingShare(shareID); pending != nil {
+			upstreamLog.Debugf("Matched accepted share %s to pending share", shareID)
+			pending.ResponseChan <- ShareResult{
+				Accepted: true,
+				Error:    nil,
+			}
+		} else {
+			upstreamLog.Warnf("Received accept for unknown or expired share: %s", shareID)
+		}
+	}
+}
+
+func (s *Session) readReject(clGw *getwork.Getwork) {
+	for {
+		rejectReason, ok := <-clGw.RejectedBlock
+		if !ok {
+			return
+		}
+
+		upstreamLog.Err("share rejected:", rejectReason)
+
+		// Get the next share ID from FIFO queue
+		shareID, ok := <-s.pending
+		if !ok {
+			upstreamLog.Warn("pending share queue closed")
+			return
+		}
+
+		// Send rejection to the waiting miner
+		if pending := s.proxy.shareTracker.GetPendingShare(shareID); pending != nil {
+			upstreamLog.Debugf("Matched rejected share %s to pending share", shareID)
+			pending.ResponseChan <- ShareResult{
+				Accepted: false,
+				Error: &stratum.Error{
+					Code:    -1,
+					Message: "rejected by pool: " + rejectReason,
+				},
+				Reason: "pool",
+			}
+		} else {
+			upstreamLog.Warnf("Received reject for unknown or expired share: %s", shareID)
+		}
+	}
+}
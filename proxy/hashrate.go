@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"xelis-mining-proxy/log"
+	"xelis-mining-proxy/util"
+)
+
+// Hashrate estimation of the proxy, and of every worker and wallet
+
+// window of the hashrate reported as "hashrate" in the stats
+const MAIN_HASHRATE_WINDOW = 15 * time.Minute
+
+// HashrateInfo describes the hashrate of a worker or wallet
+type HashrateInfo struct {
+	Name      string             `json:"name"`
+	Hashrate  float64            `json:"hashrate"`
+	Hashrates map[string]float64 `json:"hashrates"`
+	LastShare time.Time          `json:"last_share"`
+}
+
+// returns the name used to aggregate the hashrate of a worker, which is the IP if the worker has no name
+func workerName(worker, ip string) string {
+	if worker == "" {
+		return ip
+	}
+	return worker
+}
+
+func (p *Proxy) getMeter(meters map[string]*util.HashrateMeter, name string) *util.HashrateMeter {
+	m := meters[name]
+	if m == nil {
+		// windows are counted from the start of the proxy, so a new worker isn't overestimated
+		m = util.NewHashrateMeterAt(p.startTime)
+		meters[name] = m
+	}
+	return m
+}
+
+// records the work of an accepted share in the hashrate of its worker, wallet and of the whole proxy
+func (p *Proxy) addHashrateWork(worker, wallet string, work float64) {
+	p.totalHashrate.Add(work)
+
+	p.mutHashrates.Lock()
+	defer p.mutHashrates.Unlock()
+
+	p.getMeter(p.workerHashrates, worker).Add(work)
+	if wallet != "" {
+		p.getMeter(p.walletHashrates, wallet).Add(work)
+	}
+}
+
+func (p *Proxy) listHashrates(meters map[string]*util.HashrateMeter) []HashrateInfo {
+	p.mutHashrates.Lock()
+	defer p.mutHashrates.Unlock()
+
+	list := make([]HashrateInfo, 0, len(meters))
+	for name, m := range meters {
+		list = append(list, HashrateInfo{
+			Name:      name,
+			Hashrate:  m.Hashrate(MAIN_HASHRATE_WINDOW),
+			Hashrates: m.Hashrates(),
+			LastShare: m.LastShare(),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// WorkerHashrates returns the hashrate of every worker with shares in the last 24 hours, sorted by name
+func (p *Proxy) WorkerHashrates() []HashrateInfo {
+	return p.listHashrates(p.workerHashrates)
+}
+
+// removes the workers and wallets without shares in the last 24 hours
+func (p *Proxy) pruneHashrates() {
+	p.mutHashrates.Lock()
+	defer p.mutHashrates.Unlock()
+
+	for _, meters := range []map[string]*util.HashrateMeter{p.workerHashrates, p.walletHashrates} {
+		for name, m := range meters {
+			if time.Since(m.LastShare()) > 24*time.Hour {
+				delete(meters, name)
+			}
+		}
+	}
+}
+
+// periodically logs a summary of the hashrate and shares
+func (p *Proxy) hashrateLogger() {
+	for {
+		logInterval := p.getCfg().HashrateLogInterval
+		interval := time.Duration(logInterval) * time.Second
+		if interval == 0 {
+			interval = time.Minute
+		}
+		if !p.sleep(interval) {
+			return
+		}
+
+		p.pruneHashrates()
+
+		if logInterval == 0 {
+			continue
+		}
+
+		rates := p.totalHashrate.Hashrates()
+		total := p.totalStats.Snapshot()
+
+		log.Infof("Hashrate 1m %s | 15m %s | 1h %s | 24h %s | %d miners | shares: %d accepted, %d rejected, %d stale",
+			util.FormatHashrate(rates["1m"]), util.FormatHashrate(rates["15m"]), util.FormatHashrate(rates["1h"]),
+			util.FormatHashrate(rates["24h"]), len(p.Miners()), total.Accepted, total.Rejected, total.Stale)
+
+		if missing := p.missingWorkers(); len(missing) > 0 {
+			log.Warnf("%d missing workers: %s", len(missing), strings.Join(missing, ", "))
+		}
+		p.logPoolHealth()
+		p.logSplit()
+	}
+}
@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"time"
+	"xelis-mining-proxy/log"
+)
+
+// Job refresher: re-issues the current job with an updated timestamp when the pool is quiet
+
+func (p *Proxy) jobRefresher() {
+	for p.sleep(time.Second) {
+		cfg := p.getCfg()
+		if cfg.JobRefreshInterval == 0 {
+			continue
+		}
+
+		for _, s := range p.listSessions() {
+			p.refreshJob(s, cfg)
+		}
+	}
+}
+
+// re-issues the job of the session if it is older than the refresh interval
+func (p *Proxy) refreshJob(s *Session, cfg Config) {
+	job, ok := s.updateJob(func(job *Job) bool {
+		if job.Diff == 0 || time.Since(job.IssuedAt) < time.Duration(cfg.JobRefreshInterval)*time.Second {
+			return false
+		}
+
+		// never go beyond the timestamp drift accepted by the pool
+		timestamp := uint64(time.Now().UnixMilli())
+		maxTimestamp := job.UpstreamTimestamp + cfg.UpstreamTimestampDrift*1000
+		if timestamp > maxTimestamp {
+			timestamp = maxTimestamp
+		}
+		if timestamp <= job.Blob.GetTimestamp() {
+			return false
+		}
+
+		job.Blob.SetTimestamp(timestamp)
+		job.IssuedAt = time.Now()
+		return true
+	})
+	if !ok {
+		return
+	}
+
+	log.Debugf("refreshing job at height %d with timestamp %d", job.Height, job.Blob.GetTimestamp())
+
+	// the work hash is unchanged, so shares for the refreshed job still belong to the pool's job
+	go p.sendJobToWebsocket(s, job)
+	go p.sendStratumJobs(s, job, false)
+}
@@ -0,0 +1,212 @@
+package proxy
+
+import (
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+	"xelis-mining-proxy/log"
+	"xelis-mining-proxy/util"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Connection limits: IP allow and deny lists, maximum number of connections in total and per IP, connection rate
+// per IP, and request and share rate per connection
+
+// reasons of the refusals
+const (
+	REFUSED_DENIED             = "denied"
+	REFUSED_NOT_ALLOWED        = "not_allowed"
+	REFUSED_MAX_CONNECTIONS    = "max_connections"
+	REFUSED_MAX_IP_CONNECTIONS = "max_ip_connections"
+	REFUSED_CONNECTION_RATE    = "connection_rate"
+	REFUSED_REQUEST_RATE       = "request_rate"
+	REFUSED_SHARE_RATE         = "share_rate"
+)
+
+// the request and share rate limits allow bursts of this many seconds
+const LIMIT_BURST_SECONDS = 10
+
+// minimum interval between two logged refusals of the same IP
+const LIMIT_LOG_INTERVAL = time.Minute
+
+type connLimits struct {
+	lists ipLists
+
+	total int
+	perIP map[string]int
+	rates map[string]*util.RateLimiter
+
+	refused    map[string]uint64 // by reason
+	logged     map[string]time.Time
+	suppressed map[string]uint64
+	lastPrune  time.Time
+
+	metric *prometheus.CounterVec // refusals by protocol and reason
+
+	sync.Mutex
+}
+
+func newConnLimits(metric *prometheus.CounterVec) *connLimits {
+	return &connLimits{
+		perIP:      make(map[string]int),
+		rates:      make(map[string]*util.RateLimiter),
+		refused:    make(map[string]uint64),
+		logged:     make(map[string]time.Time),
+		suppressed: make(map[string]uint64),
+		metric:     metric,
+	}
+}
+
+// parsed allow and deny lists of the configuration
+type ipLists struct {
+	allowed util.IPSet // empty to allow all the IPs
+	denied  util.IPSet
+}
+
+func parseIPLists(cfg Config) (ipLists, error) {
+	allowed, err := util.ParseIPSet(cfg.AllowedIPs)
+	if err != nil {
+		return ipLists{}, fmt.Errorf("allowed_ips: %w", err)
+	}
+	denied, err := util.ParseIPSet(cfg.DeniedIPs)
+	if err != nil {
+		return ipLists{}, fmt.Errorf("denied_ips: %w", err)
+	}
+	return ipLists{allowed: allowed, denied: denied}, nil
+}
+
+// sets the allow and deny lists applied to the next connections
+func (l *connLimits) setIPLists(lists ipLists) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.lists = lists
+}
+
+// returns the reason the IP isn't allowed by the allow and deny lists, or an empty string
+// NOTE: connLimits MUST be locked before calling this
+func (l *connLimits) checkIPLists(ip string) string {
+	if l.lists.denied.Contains(ip) {
+		return REFUSED_DENIED
+	}
+	if len(l.lists.allowed) > 0 && !l.lists.allowed.Contains(ip) {
+		return REFUSED_NOT_ALLOWED
+	}
+	return ""
+}
+
+// registers a new connection of the IP, and returns true if it is allowed. release must be called when an allowed
+// connection is closed.
+func (l *connLimits) acquire(cfg Config, protocol, ip string) bool {
+	l.Lock()
+	l.prune()
+	reason := l.checkIPLists(ip)
+	if reason == "" && cfg.MaxConnections != 0 && l.total >= int(cfg.MaxConnections) {
+		reason = REFUSED_MAX_CONNECTIONS
+	}
+	if reason == "" && cfg.MaxIPConnections != 0 && l.perIP[ip] >= int(cfg.MaxIPConnections) {
+		reason = REFUSED_MAX_IP_CONNECTIONS
+	}
+	if reason == "" && cfg.IPConnectionRate != 0 {
+		r, ok := l.rates[ip]
+		if !ok {
+			r = util.NewRateLimiter(cfg.IPConnectionRate/60, max(1, cfg.IPConnectionRate))
+			l.rates[ip] = r
+		}
+		if !r.Allow() {
+			reason = REFUSED_CONNECTION_RATE
+		}
+	}
+	if reason == "" {
+		l.total++
+		l.perIP[ip]++
+	}
+	l.Unlock()
+
+	if reason != "" {
+		l.refuse(protocol, ip, reason)
+		return false
+	}
+	return true
+}
+
+// removes a closed connection of the IP
+func (l *connLimits) release(ip string) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.total--
+	l.perIP[ip]--
+	if l.perIP[ip] <= 0 {
+		delete(l.perIP, ip)
+	}
+}
+
+// forgets the connection rates and logged refusals of the IPs that didn't connect recently
+// connLimits MUST be locked before calling this
+func (l *connLimits) prune() {
+	now := time.Now()
+	if now.Sub(l.lastPrune) < LIMIT_LOG_INTERVAL {
+		return
+	}
+	l.lastPrune = now
+
+	maps.DeleteFunc(l.rates, func(_ string, r *util.RateLimiter) bool {
+		return r.FullAt(now)
+	})
+	maps.DeleteFunc(l.logged, func(ip string, t time.Time) bool {
+		if now.Sub(t) < LIMIT_LOG_INTERVAL {
+			return false
+		}
+		delete(l.suppressed, ip)
+		return true
+	})
+}
+
+// counts a refused connection, request or share, and logs it at most once per LIMIT_LOG_INTERVAL for each IP
+func (l *connLimits) refuse(protocol, ip, reason string) {
+	l.metric.WithLabelValues(protocol, reason).Inc()
+
+	l.Lock()
+	l.refused[reason]++
+	now := time.Now()
+	if last, ok := l.logged[ip]; ok && now.Sub(last) < LIMIT_LOG_INTERVAL {
+		l.suppressed[ip]++
+		l.Unlock()
+		return
+	}
+	l.logged[ip] = now
+	suppressed := l.suppressed[ip]
+	delete(l.suppressed, ip)
+	l.Unlock()
+
+	logger := log.Component(protocol).Miner(ip)
+	if suppressed > 0 {
+		logger.Warnf("Refused %s miner with IP %s: %s (%d more refusals not logged)", protocol, ip, reason, suppressed)
+	} else {
+		logger.Warnf("Refused %s miner with IP %s: %s", protocol, ip, reason)
+	}
+}
+
+// returns the number of refusals by reason
+func (l *connLimits) getRefused() map[string]uint64 {
+	l.Lock()
+	defer l.Unlock()
+
+	return maps.Clone(l.refused)
+}
+
+// returns a limiter of the requests or shares of a connection with the given rate per second, nil for no limit
+func newConnRateLimiter(rate float64) *util.RateLimiter {
+	if rate == 0 {
+		return nil
+	}
+	return util.NewRateLimiter(rate, max(1, rate*LIMIT_BURST_SECONDS))
+}
+
+// returns true if the request or share is allowed by the limiter of the connection
+func allowRate(r *util.RateLimiter) bool {
+	return r == nil || r.Allow()
+}
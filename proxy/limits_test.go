@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"testing"
+	"xelis-mining-proxy/util"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func newTestLimits() *connLimits {
+	return newConnLimits(prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test"}, []string{"protocol", "reason"}))
+}
+
+func TestCheckIPLists(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.DeniedIPs = []string{"10.0.0.5", "2001:db8::/32"}
+	cfg.AllowedIPs = []string{"10.0.0.0/8", "::1", "2001:db8::/32"}
+
+	tests := []struct {
+		addr     string
+		expected string
+	}{
+		{"10.0.0.1:4000", ""},
+		{"10.0.0.5:4000", REFUSED_DENIED},
+		{"192.168.1.1:4000", REFUSED_NOT_ALLOWED},
+		{"[::1]:37172", ""},
+		{"[::2]:37172", REFUSED_NOT_ALLOWED},
+		{"[2001:db8::5]:37172", REFUSED_DENIED},
+		{"[::ffff:10.0.0.5]:37172", REFUSED_DENIED},
+	}
+
+	lists, err := parseIPLists(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newTestLimits()
+	l.setIPLists(lists)
+
+	for _, test := range tests {
+		result := l.checkIPLists(util.RemovePort(test.addr))
+		if result != test.expected {
+			t.Errorf("checkIPLists(%q) = %q; want %q", test.addr, result, test.expected)
+		}
+	}
+}
+
+func TestConnLimits(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxConnections = 4
+	cfg.MaxIPConnections = 2
+
+	l := newTestLimits()
+	acquire := func(addr string) bool {
+		return l.acquire(cfg, "stratum", util.RemovePort(addr))
+	}
+
+	// each IPv6 client has its own count
+	if !acquire("[2001:db8::1]:1000") || !acquire("[2001:db8::1]:1001") {
+		t.Fatal("connections below the per IP limit refused")
+	}
+	if acquire("[2001:db8::1]:1002") {
+		t.Error("connection above the per IP limit allowed")
+	}
+	if !acquire("[2001:db8::2]:1000") {
+		t.Error("connection of another IPv6 client refused")
+	}
+	if !acquire("127.0.0.1:1000") {
+		t.Error("connection of an IPv4 client refused")
+	}
+	if acquire("127.0.0.2:1000") {
+		t.Error("connection above the total limit allowed")
+	}
+
+	l.release(util.RemovePort("[2001:db8::1]:1000"))
+	if !acquire("[2001:db8::1]:1003") {
+		t.Error("connection refused after a release")
+	}
+
+	refused := l.getRefused()
+	if refused[REFUSED_MAX_IP_CONNECTIONS] != 1 || refused[REFUSED_MAX_CONNECTIONS] != 1 {
+		t.Errorf("unexpected refusals %v", refused)
+	}
+}
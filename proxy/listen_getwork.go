@@ -0,0 +1,511 @@
+package proxy
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"xelis-mining-proxy/journal"
+	"xelis-mining-proxy/log"
+	"xelis-mining-proxy/util"
+
+	"github.com/gorilla/websocket"
+	"github.com/xelis-project/xelis-go-sdk/getwork"
+)
+
+// Getwork server
+
+var getworkLog = log.Component("getwork")
+
+var upgrader = websocket.Upgrader{} // use default options
+
+func fmtMessageType(mt int) string {
+	switch mt {
+	case websocket.BinaryMessage:
+		return "binary"
+	case websocket.TextMessage:
+		return "text"
+	default:
+		return "Unknown Message Type"
+	}
+}
+
+type GetworkConn struct {
+	proxy *Proxy
+
+	ID          uint64
+	conn        *websocket.Conn
+	Wallet      string
+	Worker      string
+	ConnectedAt time.Time
+
+	// jobs recently sent to this miner, used to validate submitted work
+	Jobs []PastJob
+
+	ExtraNonceSuffix uint32
+	extraNonceKey    string
+
+	// upstream session the miner's work comes from
+	session *Session
+	split   bool // true if the session was chosen by the wallet split
+
+	Stats    ShareStats
+	Hashrate *util.HashrateMeter
+
+	sync.RWMutex
+}
+
+// GetworkConn MUST be locked before calling this
+func (g *GetworkConn) WriteJSON(data interface{}) error {
+	return g.conn.WriteJSON(data)
+}
+
+// GetworkConn MUST be locked before calling this
+func (g *GetworkConn) SendJob(job Job) error {
+	bm := job.Blob
+	bm.SetExtraNonce(util.ApplyExtraNonceSuffix(bm.GetExtraNonce(), g.ExtraNonceSuffix))
+
+	g.Jobs = append(g.Jobs, PastJob{
+		BlockMiner:         bm,
+		OriginalExtraNonce: job.Blob.GetExtraNonce(),
+		Diff:               job.Diff,
+		Height:             job.Height,
+		Session:            g.session,
+	})
+	if n := g.proxy.minerJobHistory(); len(g.Jobs) > n {
+		g.Jobs = g.Jobs[len(g.Jobs)-n:]
+	}
+
+	return g.WriteJSON(map[string]any{
+		"new_job": getwork.MinerWork{
+			Difficulty: strconv.FormatUint(job.Diff, 10),
+			MinerWork:  hex.EncodeToString(bm[:]),
+			Algorithm:  job.Algorithm,
+			Height:     job.Height,
+			TopoHeight: job.TopoHeight,
+		},
+	})
+}
+
+// GetworkConn MUST be locked before calling this
+func (g *GetworkConn) SendRejected(reason string) error {
+	return g.WriteJSON(map[string]string{
+		"block_rejected": reason,
+	})
+}
+
+// returns the job issued to this miner that the submitted work was found for. Refreshed jobs keep the work hash
+// of the job they refresh, so it is the newest job with the same work hash that the work is valid for. If the
+// work is valid for none of them, the newest one is returned with the error of validate.
+// GetworkConn MUST be locked before calling this
+func (g *GetworkConn) FindJob(submitted util.BlockMiner, validate func(submitted, issued util.BlockMiner) error) (PastJob, bool, error) {
+	var newest PastJob
+	var newestErr error
+	found := false
+	for i := len(g.Jobs) - 1; i >= 0; i-- {
+		if g.Jobs[i].BlockMiner.GetWorkhash() != submitted.GetWorkhash() {
+			continue
+		}
+		err := validate(submitted, g.Jobs[i].BlockMiner)
+		if err == nil {
+			return g.Jobs[i], true, nil
+		}
+		if !found {
+			newest, newestErr, found = g.Jobs[i], err, true
+		}
+	}
+	return newest, found, newestErr
+}
+
+// returns true if the miner's work comes from the session
+func (g *GetworkConn) inSession(s *Session) bool {
+	g.RLock()
+	defer g.RUnlock()
+
+	return g.session == s
+}
+
+// moves the miner to another session, and sends it the job of that session
+func (g *GetworkConn) moveSession(s *Session) {
+	next := g.proxy.acquireSession(s.Wallet)
+
+	g.Lock()
+	prev := g.session
+	g.session = next
+	if job := next.getJob(); job.Diff != 0 {
+		if err := g.SendJob(job); err != nil {
+			getworkLog.Warn("failed to send job:", err)
+		}
+	}
+	g.Unlock()
+
+	prev.release()
+}
+
+func (g *GetworkConn) IP() string {
+	return g.conn.RemoteAddr().String()
+}
+
+func (g *GetworkConn) Close() error {
+	return g.conn.Close()
+}
+
+// sends a going away close frame, then closes the connection
+// GetworkConn MUST be locked before calling this
+func (g *GetworkConn) CloseGoingAway(reason string) error {
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, reason)
+	g.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	return g.conn.Close()
+}
+
+// returns the event of the miner
+func (g *GetworkConn) event() MinerEvent {
+	return MinerEvent{
+		ID:       g.ID,
+		Protocol: "getwork",
+		IP:       util.RemovePort(g.IP()),
+		Wallet:   g.Wallet,
+		Worker:   g.Worker,
+	}
+}
+
+// sends a job to the websockets of the session, and removes old websockets
+func (p *Proxy) sendJobToWebsocket(session *Session, job Job) {
+	p.socketsMut.Lock()
+	defer p.socketsMut.Unlock()
+
+	getworkLog.Debug("sendJobToWebsocket: num sockets:", len(p.sockets))
+
+	// remove disconnected sockets
+
+	sockets2 := make([]*GetworkConn, 0, len(p.sockets))
+	for _, c := range p.sockets {
+		if c == nil {
+			continue
+		}
+		sockets2 = append(sockets2, c)
+	}
+	getworkLog.Debug("sendJobToWebsocket: going from", len(p.sockets), "to", len(sockets2), "getwork miners")
+	p.sockets = sockets2
+	sockets := p.sockets
+
+	n := 0
+	for _, c := range sockets {
+		if c.inSession(session) {
+			n++
+		}
+	}
+	if n > 0 {
+		getworkLog.Info("Sending job to", n, "GetWork miners")
+	}
+
+	// send jobs to the remaining sockets
+
+	var wg sync.WaitGroup
+	defer func() {
+		go func() {
+			wg.Wait()
+			if n > 0 {
+				p.metrics.observeJobBroadcast("getwork", job)
+			}
+		}()
+	}()
+
+	for ix, cx := range sockets {
+		if cx == nil {
+			getworkLog.Debug("cx is nil")
+			continue
+		}
+		if !cx.inSession(session) {
+			continue
+		}
+
+		i := ix
+		c := cx
+
+		// send job in a new thread to avoid blocking the main thread and reduce latency
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Lock()
+			defer c.Unlock()
+
+			err := c.SendJob(job)
+
+			// if write failed, close the connection (if it isn't already closed) and remove it from
+			// the list of sockets
+			if err != nil {
+				getworkLog.Warn("sendJobToWebsocket: cannot send job:", err)
+				c.Close()
+
+				p.socketsMut.Lock()
+				sockets[i] = nil
+				p.socketsMut.Unlock()
+				return
+			}
+			getworkLog.Debug("sendJobToWebsocket: done, sent to IP", c.IP())
+		}()
+	}
+}
+
+// removes a disconnected miner from the list of sockets
+func (p *Proxy) removeGetworkConn(c *GetworkConn) {
+	p.socketsMut.Lock()
+	defer p.socketsMut.Unlock()
+
+	for i, v := range p.sockets {
+		if v == c {
+			p.sockets[i] = nil
+		}
+	}
+}
+
+// parses the wallet address and worker name from a getwork path (/getwork/<address>/<worker>)
+func parseGetworkPath(path string) (wallet, worker string) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if parts[0] == "getwork" {
+		parts = parts[1:]
+	}
+	if len(parts) > 0 {
+		wallet = parts[0]
+	}
+	if len(parts) > 1 {
+		worker = parts[1]
+	}
+	return
+}
+
+func getworkAddr(port uint16) string {
+	return "0.0.0.0:" + strconv.FormatUint(uint64(port), 10)
+}
+
+func (p *Proxy) wsHandler(w http.ResponseWriter, r *http.Request) {
+	ip := util.RemovePort(r.RemoteAddr)
+	pathWallet, pathWorker := parseGetworkPath(r.URL.Path)
+	if p.isIPBanned(ip) || p.isWorkerBanned(workerName(pathWorker, ip)) {
+		getworkLog.Info("Refused banned getwork miner", workerName(pathWorker, ip), "IP", ip)
+		http.Error(w, "banned", http.StatusForbidden)
+		return
+	}
+	if !p.limits.acquire(p.getCfg(), "getwork", ip) {
+		http.Error(w, "connection refused", http.StatusTooManyRequests)
+		return
+	}
+	defer p.limits.release(ip)
+
+	routed, err := p.routeWallet(pathWallet)
+	if err != nil {
+		getworkLog.Info("Refused getwork miner with wallet", pathWallet, "IP", ip+":", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		getworkLog.Warn("upgrade:", err)
+		return
+	}
+	defer conn.Close()
+
+	getworkLog.Info("Miner with IP", conn.RemoteAddr().String(), "connected to Getwork")
+
+	c := &GetworkConn{
+		proxy:         p,
+		ID:            p.newMinerID(),
+		conn:          conn,
+		ConnectedAt:   time.Now(),
+		Hashrate:      util.NewHashrateMeter(),
+		extraNonceKey: "getwork/" + util.RemovePort(conn.RemoteAddr().String()) + r.URL.Path,
+		split:         routed == "",
+	}
+	if c.split {
+		routed = p.splitSession(nil).Wallet
+	}
+	c.session = p.acquireSession(routed)
+	defer func() {
+		c.RLock()
+		defer c.RUnlock()
+		c.session.release()
+	}()
+	c.Wallet, c.Worker = parseGetworkPath(r.URL.Path)
+	c.ExtraNonceSuffix = p.extraNonces.Allocate(c.extraNonceKey)
+	defer p.extraNonces.Release(c.extraNonceKey, c.ExtraNonceSuffix)
+
+	p.socketsMut.Lock()
+	p.sockets = append(p.sockets, c)
+	p.socketsMut.Unlock()
+	defer p.removeGetworkConn(c)
+
+	worker := workerName(c.Worker, util.RemovePort(c.IP()))
+	p.minerConnected(worker)
+	defer p.minerDisconnected(worker)
+
+	emit(p, p.events.OnMinerConnected, c.event())
+	defer emit(p, p.events.OnMinerDisconnected, c.event())
+
+	// send first job
+	job := c.session.waitJob(SESSION_JOB_WAIT)
+	if job.Diff == 0 {
+		getworkLog.Debug("not sending first job, because there is no first job yet")
+		return
+	}
+
+	getworkLog.Debug("sending first job")
+
+	c.Lock()
+	err = c.SendJob(job)
+	c.Unlock()
+	if err != nil {
+		getworkLog.Warn("failed to send first job:", err)
+	}
+	// done sending first job
+
+	getworkLog.Debug("done sending first job")
+
+	cfg := p.getCfg()
+	requests := newConnRateLimiter(cfg.RequestRate)
+	shares := newConnRateLimiter(cfg.ShareRate)
+
+	for {
+		mt, message, err := c.conn.ReadMessage()
+		if err != nil {
+			getworkLog.Info("Getwork miner disconnected:", err)
+			break
+		}
+
+		getworkLog.Miner(c.IP()).Tracef("recv: %s, type: %s", message, fmtMessageType(mt))
+
+		if !allowRate(requests) {
+			p.limits.refuse("getwork", ip, REFUSED_REQUEST_RATE)
+			break
+		}
+
+		var msgJson map[string]any
+
+		err = json.Unmarshal([]byte(message), &msgJson)
+
+		if err != nil {
+			getworkLog.Err(err)
+		}
+
+		if msgJson["miner_work"] == nil {
+			if msgJson["block_template"] == nil {
+				getworkLog.Debug("miner_work and block_template are nil")
+				continue
+			} else {
+				msgJson["miner_work"] = msgJson["block_template"]
+			}
+		}
+
+		minerWork := msgJson["miner_work"].(string)
+		p.metrics.sharesSubmitted.WithLabelValues("getwork").Inc()
+
+		if !allowRate(shares) {
+			p.limits.refuse("getwork", ip, REFUSED_SHARE_RATE)
+			c.Lock()
+			c.SendRejected("too many shares")
+			c.Unlock()
+			continue
+		}
+
+		// the shares submitted during the shutdown aren't forwarded, so the pending shares can be drained
+		if p.shuttingDown.Load() {
+			c.Lock()
+			c.SendRejected("proxy shutting down")
+			c.Unlock()
+			continue
+		}
+
+		minerBlob, err := hex.DecodeString(minerWork)
+		if err != nil {
+			getworkLog.Err(err)
+			continue
+		}
+
+		if len(minerBlob) != util.BLOCKMINER_LENGTH {
+			getworkLog.Warnf("miner blob %x length is invalid", minerBlob)
+			continue
+		}
+
+		// check that the submitted work matches a job we issued to this miner
+		bm := util.BlockMiner(minerBlob)
+
+		c.Lock()
+		issued, found, err := c.FindJob(bm, p.validateShare)
+		if !found {
+			getworkLog.Miner(c.IP()).Warnf("Getwork miner %s submitted unknown work hash %x, share is probably stale", c.IP(), bm.GetWorkhash())
+			c.Stats.AddStale()
+			p.totalStats.AddStale()
+			p.metrics.sharesStale.WithLabelValues("getwork").Inc()
+			p.addRejectReason("stale share")
+			p.journalRefused(journal.EventStale, "getwork", util.RemovePort(c.IP()), workerName(c.Worker, util.RemovePort(c.IP())), c.Wallet, PastJob{}, "stale")
+			c.SendRejected("stale share")
+			c.Unlock()
+			continue
+		}
+		if err != nil {
+			getworkLog.Miner(c.IP()).Warnf("Getwork miner %s submitted invalid share: %v", c.IP(), err)
+			c.Stats.AddRejected()
+			p.totalStats.AddRejected()
+			p.metrics.sharesRejected.WithLabelValues("getwork", "invalid").Inc()
+			p.addRejectReason("invalid share")
+			p.journalRefused(journal.EventRejected, "getwork", util.RemovePort(c.IP()), workerName(c.Worker, util.RemovePort(c.IP())), c.Wallet, issued, "invalid")
+			c.SendRejected("invalid share: " + err.Error())
+			c.Unlock()
+			continue
+		}
+		c.Unlock()
+
+		// Extract share ID from the minerBlob (BlockMiner structure)
+		shareID, err := ExtractShareID(minerBlob)
+		if err != nil {
+			getworkLog.Err("failed to extract share ID:", err)
+			continue
+		}
+
+		if p.shareTracker.IsDuplicate(shareID) {
+			getworkLog.Miner(c.IP()).Warnf("Getwork miner %s submitted duplicate share %s", c.IP(), shareID)
+			c.Stats.AddRejected()
+			p.totalStats.AddRejected()
+			p.metrics.sharesDuplicate.WithLabelValues("getwork").Inc()
+			p.addRejectReason("duplicate share")
+			p.journalRefused(journal.EventRejected, "getwork", util.RemovePort(c.IP()), workerName(c.Worker, util.RemovePort(c.IP())), c.Wallet, issued, "duplicate")
+
+			c.Lock()
+			c.SendRejected("duplicate share")
+			c.Unlock()
+			continue
+		}
+
+		getworkLog.Miner(c.IP()).Debugf("Getwork miner %s found share", c.IP())
+
+		// Create pending share to await pool response
+		responseChan := make(chan ShareResult, 1)
+		pending := &PendingShare{
+			ID:                 shareID,
+			GetworkConn:        c,
+			SubmittedAt:        time.Now(),
+			ResponseChan:       responseChan,
+			Difficulty:         issued.Diff,
+			AchievedDifficulty: issued.Diff, // getwork miners don't send the PoW hash
+			Height:             issued.Height,
+			Wallet:             c.Wallet,
+			Worker:             workerName(c.Worker, util.RemovePort(c.IP())),
+			Session:            issued.Session,
+		}
+
+		// Register pending share and start response waiter
+		p.shareTracker.AddPendingShare(shareID, pending)
+		p.shareTracker.StartResponseWaiter(shareID, pending)
+		p.journalShare(journal.EventSubmitted, pending, "")
+
+		// send share to pool with ID for correlation
+		issued.Session.submit(Share{
+			ID:      shareID,
+			Encoded: minerWork,
+		})
+	}
+}
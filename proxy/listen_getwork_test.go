@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"errors"
+	"testing"
+	"xelis-mining-proxy/util"
+)
+
+func TestFindJobRefreshed(t *testing.T) {
+	const start = 1700000000000
+	const interval = 5000 // job_refresh_interval
+	const drift = 10000   // timestamp_drift
+
+	// a job and three refreshes, which keep the work hash
+	bm := util.NewBlockMiner([32]byte{1}, [32]byte{2}, [32]byte{3})
+	g := &GetworkConn{}
+	for i := uint64(0); i < 4; i++ {
+		bm.SetTimestamp(start + i*interval)
+		g.Jobs = append(g.Jobs, PastJob{BlockMiner: bm, Height: 10 + i})
+	}
+	other := util.NewBlockMiner([32]byte{4}, [32]byte{2}, [32]byte{3})
+	other.SetTimestamp(start + 4*interval)
+	g.Jobs = append(g.Jobs, PastJob{BlockMiner: other, Height: 20})
+
+	now := uint64(start + 4*interval)
+	validate := func(submitted, issued util.BlockMiner) error {
+		return util.ValidateSubmission(submitted, issued, now, drift)
+	}
+
+	tests := []struct {
+		timestamp uint64
+		height    uint64 // of the job found, 0 for an invalid share
+	}{
+		{start + 3*interval, 13},
+		{start + 2*interval + 1000, 13},
+		// too old for the newest refresh, but valid for an older one
+		{start, 12},
+		{start - 1, 11},
+		{start - drift, 10},
+		{start - drift - 1, 0},
+		{now + drift + 1, 0},
+	}
+
+	for _, test := range tests {
+		submitted := g.Jobs[0].BlockMiner
+		submitted.SetTimestamp(test.timestamp)
+		submitted.SetNonce(42)
+
+		job, found, err := g.FindJob(submitted, validate)
+		if !found {
+			t.Errorf("timestamp %d: job not found", test.timestamp)
+			continue
+		}
+		if test.height == 0 {
+			var tsErr *util.TimestampError
+			if !errors.As(err, &tsErr) || job.Height != 13 {
+				t.Errorf("timestamp %d: got job %d and error %v; want the newest job with a timestamp error", test.timestamp, job.Height, err)
+			}
+			continue
+		}
+		if err != nil || job.Height != test.height {
+			t.Errorf("timestamp %d: got job %d and error %v; want job %d", test.timestamp, job.Height, err, test.height)
+		}
+	}
+
+	unknown := util.NewBlockMiner([32]byte{5}, [32]byte{2}, [32]byte{3})
+	if _, found, _ := g.FindJob(unknown, validate); found {
+		t.Error("job found for an unknown work hash")
+	}
+}
@@ -0,0 +1,927 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"xelis-mining-proxy/config"
+	"xelis-mining-proxy/journal"
+	"xelis-mining-proxy/log"
+	"xelis-mining-proxy/stratum"
+	"xelis-mining-proxy/util"
+)
+
+// Stratum server
+
+var stratumLog = log.Component("stratum")
+
+// number of jobs with a different work hash remembered per miner, in addition to the refreshes of the current job
+const JOBS_PAST = 5
+
+// returns the number of jobs remembered per miner. A refreshed job isn't clean, so the miners can keep submitting
+// shares for all the refreshes of a pool job, which are refreshed at most until the upstream timestamp drift.
+func (p *Proxy) minerJobHistory() int {
+	cfg := p.getCfg()
+	if cfg.JobRefreshInterval == 0 {
+		return JOBS_PAST
+	}
+	return JOBS_PAST + int(cfg.UpstreamTimestampDrift/cfg.JobRefreshInterval)
+}
+
+type PastJob struct {
+	JobID              [16]byte
+	BlockMiner         util.BlockMiner // BlockMiner with modified extra_nonce for this miner
+	OriginalExtraNonce [32]byte        // Original extra_nonce from pool (must be restored when submitting)
+	Diff               uint64          // difficulty assigned to the miner for this job
+	Height             uint64
+	Session            *Session // upstream session the job comes from
+}
+
+type StratumServer struct {
+	Conns []*StratumConn
+
+	sync.RWMutex
+}
+
+type StratumConn struct {
+	proxy *Proxy
+
+	ID          uint64
+	Conn        net.Conn
+	Alive       bool
+	IP          string
+	LastOutID   uint32
+	Jobs        []PastJob
+	Agent       string
+	SessionID   string // stratum session ID, sent back by the miners resuming their session when reconnecting
+	Wallet      string
+	Worker      string
+	Ready       bool
+	ConnectedAt time.Time
+
+	ExtraNonce       [32]byte
+	ExtraNonceSuffix uint32
+	HasExtraNonce    bool
+	released         bool // set when the extra nonce is given back, no other one is allocated after that
+
+	// upstream session the miner's work comes from, and session whose public key was sent when subscribing
+	session    *Session
+	subscribed *Session
+	PublicKey  [32]byte
+	split      bool // true if the session was chosen by the wallet split
+
+	Stats    ShareStats
+	Hashrate *util.HashrateMeter
+
+	sync.RWMutex
+}
+
+// StratumConn MUST be locked before calling this
+func (g *StratumConn) WriteJSON(data any) error {
+	bin, err := json.Marshal(data)
+
+	if err != nil {
+		return err
+	}
+
+	stratumLog.Miner(g.IP).Trace("stratum >>>", string(bin))
+
+	_, err = g.Conn.Write(append(bin, []byte("\n")...))
+	return err
+}
+
+func (g *StratumConn) Close() error {
+	g.Alive = false
+	return g.Conn.Close()
+}
+
+func stratumAddr(port uint16) string {
+	return "0.0.0.0:" + strconv.FormatUint(uint64(port), 10)
+}
+
+// periodically pings the stratum miners, so they don't time out
+func (p *Proxy) stratumPinger() {
+	s := p.stratumServer
+	for p.sleep((config.SLAVE_MINER_TIMEOUT - 5) * time.Second) {
+		s.Lock()
+		for _, v := range s.Conns {
+			go func() {
+				v.Lock()
+				defer v.Unlock()
+
+				v.LastOutID++
+				v.WriteJSON(stratum.RequestOut{
+					Id:     v.LastOutID,
+					Method: "mining.ping",
+					Params: nil,
+				})
+			}()
+		}
+		s.Unlock()
+	}
+}
+
+// accepts the incoming connections and handles them, until the listener is closed
+func (p *Proxy) serveStratum(listener net.Listener) {
+	s := p.stratumServer
+	for {
+		Conn, err := listener.Accept()
+		if err != nil {
+			if isListenerClosed(err) {
+				return
+			}
+			stratumLog.Warn(err)
+			continue
+		}
+
+		ip := util.RemovePort(Conn.RemoteAddr().String())
+		if p.isIPBanned(ip) {
+			stratumLog.Info("Refused stratum connection of banned IP", ip)
+			Conn.Close()
+			continue
+		}
+		if !p.limits.acquire(p.getCfg(), "stratum", ip) {
+			Conn.Close()
+			continue
+		}
+
+		sConn := &StratumConn{
+			proxy:       p,
+			ID:          p.newMinerID(),
+			Conn:        Conn,
+			Jobs:        make([]PastJob, 0, JOBS_PAST),
+			ConnectedAt: time.Now(),
+			Hashrate:    util.NewHashrateMeter(),
+			session:     p.defaultSession,
+		}
+
+		sConn.Alive = true
+		sConn.IP = ip
+
+		s.Lock()
+		s.Conns = append(s.Conns, sConn)
+		s.Unlock()
+
+		// Handle the connection in a new goroutine
+		go p.handleStratumConn(sConn)
+	}
+}
+
+func GenerateID() [16]byte {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return [16]byte(id)
+}
+
+// returns the event of the miner
+//
+// NOTE: StratumConn MUST be locked before calling this
+func (c *StratumConn) event() MinerEvent {
+	return MinerEvent{
+		ID:       c.ID,
+		Protocol: "stratum",
+		IP:       c.IP,
+		Wallet:   c.Wallet,
+		Worker:   c.Worker,
+	}
+}
+
+func (p *Proxy) handleStratumConn(c *StratumConn) {
+	defer p.limits.release(c.IP)
+	defer c.releaseExtraNonce()
+
+	// worker name, set on the first authorization
+	worker := ""
+	defer func() {
+		if worker != "" {
+			p.minerDisconnected(worker)
+
+			c.RLock()
+			emit(p, p.events.OnMinerDisconnected, c.event())
+			c.RUnlock()
+		}
+	}()
+	defer func() {
+		c.RLock()
+		defer c.RUnlock()
+		c.session.release()
+	}()
+
+	rdr := bufio.NewReader(c.Conn)
+
+	numMessages := 0
+
+	cfg := p.getCfg()
+	requests := newConnRateLimiter(cfg.RequestRate)
+	shares := newConnRateLimiter(cfg.ShareRate)
+
+	for {
+		c.Lock()
+		var err error
+		if numMessages < 2 {
+			err = c.Conn.SetReadDeadline(time.Now().Add(config.TIMEOUT * time.Second))
+		} else {
+			err = c.Conn.SetReadDeadline(time.Now().Add(config.SLAVE_MINER_TIMEOUT * time.Second))
+		}
+		c.Unlock()
+		numMessages++
+
+		if err != nil {
+			stratumLog.Warn("Miner", c.IP, "disconnected:", err)
+			c.Conn.Close()
+			c.Alive = false
+			return
+		}
+
+		str, err := rdr.ReadString('\n')
+		if err != nil {
+			stratumLog.Warn("Miner", c.IP, "disconnected:", err)
+			c.Conn.Close()
+			c.Alive = false
+			return
+		}
+
+		stratumLog.Miner(c.IP).Trace("stratum <<<", str)
+
+		if !allowRate(requests) {
+			p.limits.refuse("stratum", c.IP, REFUSED_REQUEST_RATE)
+			c.Lock()
+			c.Close()
+			c.Unlock()
+			return
+		}
+
+		req := stratum.RequestIn{}
+
+		err = json.Unmarshal([]byte(str), &req)
+		if err != nil {
+			stratumLog.Warn(err)
+			c.Close()
+			c.Alive = false
+			return
+		}
+
+		switch req.Method {
+		case "mining.subscribe":
+			params := []any{}
+			err := json.Unmarshal(req.Params, &params)
+			if err != nil {
+				stratumLog.Warn(err)
+				c.Close()
+				c.Alive = false
+				return
+			}
+
+			c.Agent = params[0].(string)
+
+			stratumLog.Info("Stratum miner with agent", c.Agent, "and IP", c.IP, "connected")
+
+			// the 2nd param is the optional session ID of a miner resuming its session
+			resumed := ""
+			if len(params) > 1 {
+				resumed, _ = params[1].(string)
+			}
+
+			// the public key can't be changed after subscribing, so a miner asked to reconnect by wallet routing
+			// gets the public key of its wallet
+			subscribed := p.subscribeSession(c.extraNonceKey(), resumed)
+			job := subscribed.waitJob(SESSION_JOB_WAIT)
+
+			if len(params) < 1 {
+				stratumLog.Warn("less than 1 param")
+				c.Close()
+				c.Alive = false
+				return
+			}
+
+			c.Lock()
+
+			stratumLog.Debugf("sending Stratum informations to miner with IP %s", c.IP)
+
+			xnonce, ok := c.ensureExtraNonce(job)
+			pubkey := job.Blob.GetPublickey()
+
+			if !ok || pubkey == [32]byte{} {
+				c.WriteJSON(stratum.ResponseOut{
+					Id: req.Id,
+					Error: &stratum.Error{
+						Code:    -1,
+						Message: "no job yet",
+					},
+				})
+				c.Close()
+				c.Unlock()
+				return
+			}
+			c.PublicKey = pubkey
+			c.subscribed = subscribed
+			c.SessionID = resumed
+			if c.SessionID == "" {
+				c.SessionID = GenerateSessionID()
+			}
+
+			err = c.WriteJSON(stratum.ResponseOut{
+				Id: req.Id,
+				Result: []any{
+					c.SessionID,                   // session id
+					hex.EncodeToString(xnonce[:]), // extra nonce
+					32,                            // useless (extra nonce length)
+					hex.EncodeToString(pubkey[:]), // public key
+				},
+			})
+
+			if err != nil {
+				stratumLog.Warn(err)
+				c.Alive = false
+				c.Unlock()
+				return
+			}
+			c.Unlock()
+		case "mining.authorize":
+			params := []string{}
+
+			err := json.Unmarshal(req.Params, &params)
+			if err != nil {
+				stratumLog.Warn(err)
+				c.Close()
+				c.Alive = false
+				return
+			}
+
+			if len(params) < 3 {
+				stratumLog.Warn("less than 3 params")
+				c.Close()
+				c.Alive = false
+				return
+			}
+
+			params[0] = strings.ReplaceAll(params[0], ".", "+")
+
+			splAddr := strings.Split(params[0], "+")
+
+			wall := splAddr[0]
+
+			stratumLog.Info("Stratum miner with address", wall, "IP", c.IP, "connected")
+			c.Lock()
+			c.Alive = true
+			c.Wallet = wall
+			if len(splAddr) > 1 {
+				c.Worker = splAddr[1]
+			}
+			c.Unlock()
+
+			if p.isWorkerBanned(workerName(c.Worker, c.IP)) {
+				stratumLog.Info("Refused banned worker", workerName(c.Worker, c.IP), "IP", c.IP)
+				c.Lock()
+				c.WriteJSON(stratum.ResponseOut{
+					Id:     req.Id,
+					Result: false,
+					Error: &stratum.Error{
+						Code:    -1,
+						Message: "banned",
+					},
+				})
+				c.Close()
+				c.Unlock()
+				return
+			}
+
+			routed, err := p.routeWallet(wall)
+			if err != nil {
+				stratumLog.Info("Refused Stratum miner with wallet", wall, "IP", c.IP+":", err)
+				c.Lock()
+				c.WriteJSON(stratum.ResponseOut{
+					Id:     req.Id,
+					Result: false,
+					Error: &stratum.Error{
+						Code:    -1,
+						Message: err.Error(),
+					},
+				})
+				c.Close()
+				c.Unlock()
+				return
+			}
+
+			// the miners mining to the configured wallet keep the session chosen by the wallet split when subscribing
+			c.RLock()
+			subscribed := c.subscribed
+			c.RUnlock()
+			split := routed == ""
+			if split {
+				routed = p.splitSession(subscribed).Wallet
+			}
+
+			session := p.acquireSession(routed)
+			c.Lock()
+			prevSession := c.session
+			c.session = session
+			c.split = split
+			c.Unlock()
+			prevSession.release()
+
+			if worker == "" {
+				worker = workerName(c.Worker, c.IP)
+				p.minerConnected(worker)
+
+				c.RLock()
+				emit(p, p.events.OnMinerConnected, c.event())
+				c.RUnlock()
+			}
+
+			// send the job
+			job := session.waitJob(SESSION_JOB_WAIT)
+
+			if c.PublicKey != [32]byte{} && job.Blob.GetPublickey() != c.PublicKey {
+				// the miner subscribed with the public key of another session: it reconnects to get the right one
+				stratumLog.Info("Asking Stratum miner with IP", c.IP, "to reconnect to mine to wallet",
+					session.wallet(p.getCfg()))
+				c.RLock()
+				p.setRouteHint(c.extraNonceKey(), c.SessionID, session.Wallet)
+				c.RUnlock()
+
+				c.Lock()
+				c.WriteJSON(stratum.ResponseOut{
+					Id:     req.Id,
+					Result: true,
+				})
+				c.SendReconnect()
+				c.Close()
+				c.Unlock()
+				return
+			}
+
+			// first, send response
+			c.Lock()
+			err = c.WriteJSON(stratum.ResponseOut{
+				Id:     req.Id,
+				Result: true,
+			})
+			if err != nil {
+				stratumLog.Warn("failed to send response")
+				c.Close()
+				c.Unlock()
+				return
+			}
+
+			// send actual job
+			SendStratumJob(c, job, true)
+
+			c.Unlock()
+
+		case "mining.submit":
+			p.metrics.sharesSubmitted.WithLabelValues("stratum").Inc()
+
+			if !allowRate(shares) {
+				p.limits.refuse("stratum", c.IP, REFUSED_SHARE_RATE)
+				c.Lock()
+				c.WriteJSON(stratum.ResponseOut{
+					Id:     req.Id,
+					Result: false,
+					Error: &stratum.Error{
+						Code:    -1,
+						Message: "too many shares",
+					},
+				})
+				c.Unlock()
+				continue
+			}
+
+			// the shares submitted during the shutdown aren't forwarded, so the pending shares can be drained
+			if p.shuttingDown.Load() {
+				c.Lock()
+				c.WriteJSON(stratum.ResponseOut{
+					Id:     req.Id,
+					Result: false,
+					Error: &stratum.Error{
+						Code:    -1,
+						Message: "proxy shutting down",
+					},
+				})
+				c.Unlock()
+				continue
+			}
+
+			params := []string{}
+
+			err := json.Unmarshal(req.Params, &params)
+			if err != nil {
+				stratumLog.Warn(err)
+				c.Close()
+				c.Alive = false
+				return
+			}
+
+			// the 4th param is the optional PoW hash of the share, used for statistics
+			if len(params) != 3 && len(params) != 4 {
+				stratumLog.Warn("params length is not 3 or 4")
+				c.Close()
+				c.Alive = false
+				return
+			}
+
+			jid, err := hex.DecodeString(params[1])
+			if err != nil {
+				stratumLog.Warn(err)
+				c.Close()
+				c.Alive = false
+				return
+			}
+			nonceBin, err := hex.DecodeString(params[2])
+
+			if err != nil {
+				stratumLog.Warn(err)
+				c.Close()
+				c.Alive = false
+				return
+			}
+
+			if len(jid) != 16 || len(nonceBin) != 8 {
+				stratumLog.Warnf("jobid %x nonce %x do not match expected length (16, 8)", jid, nonceBin)
+				c.Close()
+				c.Alive = false
+				return
+			}
+
+			jobid := [16]byte(jid)
+
+			// get the BlockMiner for the current job
+			var bm util.BlockMiner
+			var pastJob PastJob
+			found := false
+			c.RLock()
+			for _, v := range c.Jobs {
+				if v.JobID == jobid {
+					stratumLog.Debugf("job id %x matches", jobid)
+					pastJob = v
+					bm = v.BlockMiner
+					stratumLog.Debugf("blockMiner is %x", bm)
+					stratumLog.Debugf("extra_nonce: %x", bm.GetExtraNonce())
+					found = true
+
+					// the bug is before this
+					break
+				}
+				stratumLog.Debugf("job id %x doesn't match with %x", jobid, v.JobID)
+			}
+			c.RUnlock()
+
+			if !found {
+				stratumLog.Miner(c.IP).Warnf("unknown job id %x, share is probably stale", jobid)
+				c.Stats.AddStale()
+				p.totalStats.AddStale()
+				p.metrics.sharesStale.WithLabelValues("stratum").Inc()
+				p.addRejectReason("stale share")
+				p.journalRefused(journal.EventStale, "stratum", c.IP, workerName(c.Worker, c.IP), c.Wallet, PastJob{}, "stale")
+
+				// the share is rejected, but the miner keeps its connection and gets the next jobs
+				c.Lock()
+				c.WriteJSON(stratum.ResponseOut{
+					Id:     req.Id,
+					Result: false,
+					Error: &stratum.Error{
+						Code:    -1,
+						Message: "stale share",
+					},
+				})
+				c.Unlock()
+
+				continue
+			}
+
+			// stratum miners only send a nonce: the rest of the blob is the job issued to this miner, found by its
+			// ID, so unlike getwork there is no submitted work hash, public key, extra nonce or timestamp to validate
+			bm.SetNonceBytes([8]byte(nonceBin))
+
+			// the PoW hash is reported by the miner, without a PoW hash the assigned difficulty is the lower bound of the
+			// achieved difficulty
+			achieved := pastJob.Diff
+			if len(params) == 4 {
+				powHash, err := hex.DecodeString(params[3])
+				if err != nil || len(powHash) != 32 {
+					stratumLog.Miner(c.IP).Warnf("Stratum miner %s sent invalid PoW hash %s", c.IP, params[3])
+				} else if d := util.HashToDifficulty([32]byte(powHash)); d > achieved {
+					achieved = d
+				}
+			}
+
+			// Generate unique share ID from extra nonce + nonce
+			shareID := GenerateShareID(bm.GetExtraNonce(), [8]byte(nonceBin))
+
+			if p.shareTracker.IsDuplicate(shareID) {
+				stratumLog.Miner(c.IP).Warnf("Stratum miner %s submitted duplicate share %s", c.IP, shareID)
+				c.Stats.AddRejected()
+				p.totalStats.AddRejected()
+				p.metrics.sharesDuplicate.WithLabelValues("stratum").Inc()
+				p.addRejectReason("duplicate share")
+				p.journalRefused(journal.EventRejected, "stratum", c.IP, workerName(c.Worker, c.IP), c.Wallet, pastJob, "duplicate")
+
+				c.Lock()
+				c.WriteJSON(stratum.ResponseOut{
+					Id:     req.Id,
+					Result: false,
+					Error: &stratum.Error{
+						Code:    -1,
+						Message: "duplicate share",
+					},
+				})
+				c.Unlock()
+
+				continue
+			}
+
+			// Create pending share to await pool response
+			responseChan := make(chan ShareResult, 1)
+			pending := &PendingShare{
+				ID:                 shareID,
+				RequestID:          req.Id,
+				StratumConn:        c,
+				SubmittedAt:        time.Now(),
+				ResponseChan:       responseChan,
+				Difficulty:         pastJob.Diff,
+				AchievedDifficulty: achieved,
+				Height:             pastJob.Height,
+				Wallet:             c.Wallet,
+				Worker:             workerName(c.Worker, c.IP),
+				Session:            pastJob.Session,
+			}
+
+			// Register pending share and start response waiter
+			p.shareTracker.AddPendingShare(shareID, pending)
+			p.shareTracker.StartResponseWaiter(shareID, pending)
+			p.journalShare(journal.EventSubmitted, pending, "")
+
+			// Submit blob to pool (extra_nonce unchanged from pool's template)
+			pastJob.Session.submit(Share{
+				ID:      shareID,
+				Encoded: bm.String(),
+			})
+		default:
+			if req.Method != "mining.pong" {
+				stratumLog.Warn("Unknown Stratum method", req.Method)
+			}
+		}
+
+	}
+
+}
+
+// NOTE: StratumConn MUST be locked before calling this
+func (c *StratumConn) SendDifficulty(diff uint64) error {
+	c.LastOutID++
+
+	if diff == 0 {
+		diff = 18446744073709551615
+	}
+
+	return c.WriteJSON(stratum.RequestOut{
+		Id:     c.LastOutID,
+		Method: "mining.set_difficulty",
+		Params: []uint64{diff},
+	})
+}
+
+// asks the miner to reconnect, to get the public key of another session when subscribing again
+func (c *StratumConn) moveSession(s *Session) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.proxy.setRouteHint(c.extraNonceKey(), c.SessionID, s.Wallet)
+
+	c.SendReconnect()
+	c.Close()
+}
+
+// NOTE: StratumConn MUST be locked before calling this
+func (c *StratumConn) SendReconnect() error {
+	c.LastOutID++
+
+	// without parameters, the miner reconnects to the same host and port
+	return c.WriteJSON(stratum.RequestOut{
+		Id:     c.LastOutID,
+		Method: "client.reconnect",
+		Params: []any{},
+	})
+}
+
+// returns a random stratum session ID
+func GenerateSessionID() string {
+	b := make([]byte, 8)
+
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+func GenerateJobID() [16]byte {
+	b := make([]byte, 16)
+
+	rand.Read(b)
+
+	return [16]byte(b)
+}
+
+// clean is false when the job only refreshes the previous one, so the miner can keep submitting shares
+// for older jobs
+func (c *StratumConn) SendJob(bm util.BlockMiner, jobid [16]byte, job Job, clean bool) error {
+	c.LastOutID++
+
+	workhash := bm.GetWorkhash()
+
+	timeStr := strconv.FormatUint(bm.GetTimestamp(), 16)
+
+	xn := bm.GetExtraNonce()
+
+	err := c.WriteJSON(stratum.RequestOut{
+		Id:     c.LastOutID,
+		Method: "mining.set_extranonce",
+		Params: []any{
+			hex.EncodeToString(xn[:]),
+			len(xn),
+		},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	c.LastOutID++
+
+	algorithm := util.AlgorithmNodeToStratum(job.Algorithm)
+
+	return c.WriteJSON(stratum.RequestOut{
+		Id:     c.LastOutID,
+		Method: "mining.notify",
+		Params: []any{
+			hex.EncodeToString(jobid[:]),
+			timeStr,
+			hex.EncodeToString(workhash[:]),
+			algorithm,
+			clean,
+		},
+	})
+}
+
+// returns the key used to give back the same extra nonce to a reconnecting miner
+func (c *StratumConn) extraNonceKey() string {
+	return "stratum/" + c.IP + "/" + c.Agent
+}
+
+// returns the extra nonce of the miner, allocating it on the first call. It returns false once the miner
+// disconnected, so that a job sent concurrently with the disconnection doesn't allocate an extra nonce that is
+// never released.
+// NOTE: StratumConn MUST be locked before calling this
+func (c *StratumConn) ensureExtraNonce(job Job) ([32]byte, bool) {
+	if c.released {
+		return [32]byte{}, false
+	}
+	if c.HasExtraNonce {
+		return c.ExtraNonce, true
+	}
+
+	c.ExtraNonceSuffix = c.proxy.extraNonces.Allocate(c.extraNonceKey())
+	c.ExtraNonce = util.ApplyExtraNonceSuffix(job.Blob.GetExtraNonce(), c.ExtraNonceSuffix)
+	c.HasExtraNonce = true
+
+	stratumLog.Debugf("allocated extra nonce %x to Stratum miner with IP %s", c.ExtraNonce, c.IP)
+	return c.ExtraNonce, true
+}
+
+// gives back the extra nonce of a disconnected miner
+func (c *StratumConn) releaseExtraNonce() {
+	c.Lock()
+	defer c.Unlock()
+
+	c.released = true
+	if !c.HasExtraNonce {
+		return
+	}
+	c.proxy.extraNonces.Release(c.extraNonceKey(), c.ExtraNonceSuffix)
+	c.HasExtraNonce = false
+}
+
+// NOTE: StratumConn MUST be locked before calling this
+func SendStratumJob(v *StratumConn, job Job, clean bool) {
+	stratumLog.Debug("SendJob to Stratum miner with IP", v.Conn.RemoteAddr().String())
+
+	jobId := make([]byte, 16)
+	_, err := rand.Read(jobId)
+	if err != nil {
+		stratumLog.Err(err)
+		return
+	}
+
+	blob := job.Blob
+	xnonce, ok := v.ensureExtraNonce(job)
+	if !ok {
+		stratumLog.Debug("not sending job to disconnected Stratum miner with IP", v.IP)
+		return
+	}
+	blob.SetExtraNonce(xnonce)
+
+	stratumLog.Debugf("SendStratumJob blob %x", blob)
+	stratumLog.Debug("SendStratumJob:", blob.Display())
+
+	// add the job to miner's known past jobs
+	v.Jobs = append(v.Jobs, PastJob{
+		JobID:              [16]byte(jobId),
+		BlockMiner:         blob,
+		OriginalExtraNonce: xnonce,
+		Diff:               job.Diff,
+		Height:             job.Height,
+		Session:            v.session,
+	})
+	if n := v.proxy.minerJobHistory(); len(v.Jobs) > n {
+		v.Jobs = v.Jobs[len(v.Jobs)-n:]
+	}
+
+	stratumLog.Debugf("sending job to Stratum miner with IP %s (job id %x) ok", v.IP, jobId)
+
+	v.SendDifficulty(job.Diff)
+	v.SendJob(blob, [16]byte(jobId), job, clean)
+}
+
+// sends a job to the stratum miners of the session, and removes the disconnected miners
+func (p *Proxy) sendStratumJobs(session *Session, job Job, clean bool) {
+	s := p.stratumServer
+	s.Lock()
+	stratumLog.Debug("StratumServer sendJobs: num sockets:", len(s.Conns))
+
+	// remove disconnected sockets
+
+	sockets2 := make([]*StratumConn, 0, len(s.Conns))
+	for _, c := range s.Conns {
+		if c == nil {
+			stratumLog.Err("THIS SHOULD NOT HAPPEN - connection is nil")
+			continue
+		}
+		if !c.Alive {
+			stratumLog.Debug("connection with IP", c.IP, "disconnected")
+
+			continue
+		}
+		sockets2 = append(sockets2, c)
+	}
+	stratumLog.Debug("StratumServer sendJobs: going from", len(s.Conns), "to", len(sockets2), "Stratum miners")
+	s.Conns = sockets2
+	s.Unlock()
+
+	targets := make([]*StratumConn, 0, len(sockets2))
+	for _, c := range sockets2 {
+		c.RLock()
+		if c.session == session {
+			targets = append(targets, c)
+		}
+		c.RUnlock()
+	}
+	sockets2 = targets
+
+	if len(sockets2) > 0 {
+		if clean {
+			stratumLog.Info("Sending job to", len(sockets2), "Stratum miners")
+		} else {
+			stratumLog.Debug("Refreshing job for", len(sockets2), "Stratum miners")
+		}
+	}
+
+	// send jobs to the remaining sockets
+
+	var wg sync.WaitGroup
+	defer func() {
+		go func() {
+			wg.Wait()
+			if len(sockets2) > 0 {
+				p.metrics.observeJobBroadcast("stratum", job)
+			}
+		}()
+	}()
+
+	for _, cx := range sockets2 {
+		if cx == nil {
+			stratumLog.Debug("cx is nil")
+			continue
+		}
+
+		c := cx
+
+		// send job in a new thread to avoid blocking the main thread and reduce latency
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stratumLog.Debug("StratumServer sendJobs: sending to IP", c.IP)
+
+			c.Lock()
+			defer c.Unlock()
+
+			SendStratumJob(c, job, clean)
+
+			stratumLog.Debug("StratumServer sendJobs: done, sent to IP", c.IP)
+		}()
+	}
+}
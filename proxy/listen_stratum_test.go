@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+	"xelis-mining-proxy/util"
+)
+
+func TestExtraNonceReleasedOnce(t *testing.T) {
+	p := &Proxy{extraNonces: util.NewExtraNonceAllocator(0)}
+	job := Job{Blob: util.NewBlockMiner([32]byte{1}, [32]byte{2}, [32]byte{3}), Diff: 1000}
+
+	conn, other := net.Pipe()
+	defer other.Close()
+	// nothing reads the pipe, so a job sent to the miner fails instead of blocking
+	conn.SetWriteDeadline(time.Now().Add(time.Second))
+
+	c := &StratumConn{proxy: p, Conn: conn, IP: "127.0.0.1", Agent: "test"}
+
+	c.Lock()
+	_, ok := c.ensureExtraNonce(job)
+	c.Unlock()
+	if !ok {
+		t.Fatal("no extra nonce allocated")
+	}
+	if n := p.extraNonces.InUse(); n != 1 {
+		t.Fatalf("%d extra nonces in use; want 1", n)
+	}
+
+	c.releaseExtraNonce()
+
+	// a job broadcast racing with the disconnection
+	c.Lock()
+	SendStratumJob(c, job, true)
+	_, ok = c.ensureExtraNonce(job)
+	c.Unlock()
+
+	if ok {
+		t.Error("extra nonce allocated after the release")
+	}
+	if len(c.Jobs) != 0 {
+		t.Error("job sent after the release")
+	}
+	if c.HasExtraNonce {
+		t.Error("extra nonce held after the release")
+	}
+
+	// without a reuse timeout, the released suffix goes to the next miner
+	time.Sleep(time.Millisecond)
+	if suffix := p.extraNonces.Allocate("stratum/127.0.0.2/test"); suffix != c.ExtraNonceSuffix {
+		t.Errorf("next miner got suffix %d; want the released suffix %d", suffix, c.ExtraNonceSuffix)
+	}
+}
+
+func TestStratumJobHistory(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.JobRefreshInterval = 5
+	cfg.UpstreamTimestampDrift = 60
+	p := &Proxy{cfg: cfg, extraNonces: util.NewExtraNonceAllocator(0)}
+
+	conn, other := net.Pipe()
+	defer conn.Close()
+	go io.Copy(io.Discard, other)
+
+	c := &StratumConn{proxy: p, Conn: conn, IP: "127.0.0.1", Agent: "test"}
+	job := Job{Blob: util.NewBlockMiner([32]byte{1}, [32]byte{2}, [32]byte{3}), Diff: 1000}
+
+	// a pool job refreshed until the upstream timestamp drift, then the next pool jobs
+	c.Lock()
+	for i := 0; i <= 12+JOBS_PAST; i++ {
+		job.Height = uint64(i)
+		SendStratumJob(c, job, i > 12)
+	}
+	c.Unlock()
+
+	if want := JOBS_PAST + 12; len(c.Jobs) != want {
+		t.Fatalf("%d jobs remembered; want %d", len(c.Jobs), want)
+	}
+	if h := c.Jobs[0].Height; h != 1 {
+		t.Errorf("oldest job remembered at height %d; want 1", h)
+	}
+
+	cfg.JobRefreshInterval = 0
+	p.cfg = cfg
+	c.Lock()
+	SendStratumJob(c, job, true)
+	c.Unlock()
+	if len(c.Jobs) != JOBS_PAST {
+		t.Errorf("%d jobs remembered without job refresh; want %d", len(c.Jobs), JOBS_PAST)
+	}
+}
@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// Listener is a server socket that can move to another address without closing the connections it accepted
+type Listener struct {
+	name  string
+	serve func(l net.Listener) // serves the socket until it is closed
+	addr  string
+	l     net.Listener
+
+	sync.Mutex
+}
+
+func newListener(name string, serve func(l net.Listener)) *Listener {
+	return &Listener{
+		name:  name,
+		serve: serve,
+	}
+}
+
+// Bind opens a socket on the address and serves it, then closes the previous socket
+func (l *Listener) Bind(addr string) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.l != nil && l.addr == addr {
+		return nil
+	}
+
+	nl, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go l.serve(nl)
+
+	if l.l != nil {
+		l.l.Close()
+	}
+	l.l = nl
+	l.addr = addr
+
+	return nil
+}
+
+// Close closes the socket, the accepted connections stay open
+func (l *Listener) Close() {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.l != nil {
+		l.l.Close()
+		l.l = nil
+		l.addr = ""
+	}
+}
+
+// returns true if the error was returned because the socket was closed by Bind or Close
+func isListenerClosed(err error) bool {
+	return errors.Is(err, net.ErrClosed)
+}
@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+	"xelis-mining-proxy/util"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus metrics
+
+type metrics struct {
+	registry *prometheus.Registry
+
+	sharesSubmitted *prometheus.CounterVec
+	sharesAccepted  *prometheus.CounterVec
+	sharesRejected  *prometheus.CounterVec
+	sharesStale     *prometheus.CounterVec
+	sharesDuplicate *prometheus.CounterVec
+	sharesTimedOut  *prometheus.CounterVec
+	limitRefusals   *prometheus.CounterVec
+
+	shareRoundTrip *prometheus.HistogramVec
+	jobBroadcast   *prometheus.HistogramVec
+}
+
+// creates the metrics of the proxy, in a registry of its own
+func newMetrics(p *Proxy) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+
+		sharesSubmitted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "xmp_shares_submitted_total",
+			Help: "Shares submitted by the miners",
+		}, []string{"protocol"}),
+		sharesAccepted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "xmp_shares_accepted_total",
+			Help: "Shares accepted by the pool",
+		}, []string{"protocol"}),
+		sharesRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "xmp_shares_rejected_total",
+			Help: "Shares rejected by the pool or by the proxy",
+		}, []string{"protocol", "reason"}),
+		sharesStale: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "xmp_shares_stale_total",
+			Help: "Shares submitted for an unknown or expired job",
+		}, []string{"protocol"}),
+		sharesDuplicate: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "xmp_shares_duplicate_total",
+			Help: "Shares submitted more than once",
+		}, []string{"protocol"}),
+		sharesTimedOut: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "xmp_shares_timed_out_total",
+			Help: "Shares the pool didn't answer in time",
+		}, []string{"protocol"}),
+		limitRefusals: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "xmp_limit_refusals_total",
+			Help: "Connections, requests and shares refused by the connection limits",
+		}, []string{"protocol", "reason"}),
+
+		shareRoundTrip: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "xmp_share_round_trip_seconds",
+			Help:    "Time between the submission of a share and the pool response",
+			Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+		}, []string{"protocol"}),
+		jobBroadcast: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "xmp_job_broadcast_seconds",
+			Help:    "Time between the receipt of a job and the last miner being notified",
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 12),
+		}, []string{"protocol"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.sharesSubmitted,
+		m.sharesAccepted,
+		m.sharesRejected,
+		m.sharesStale,
+		m.sharesDuplicate,
+		m.sharesTimedOut,
+		m.limitRefusals,
+		m.shareRoundTrip,
+		m.jobBroadcast,
+	)
+
+	for _, protocol := range []string{"stratum", "getwork"} {
+		m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "xmp_miners_connected",
+			Help:        "Connected miners",
+			ConstLabels: prometheus.Labels{"protocol": protocol},
+		}, func() float64 {
+			n := 0
+			for _, m := range p.Miners() {
+				if m.Protocol == protocol {
+					n++
+				}
+			}
+			return float64(n)
+		}))
+	}
+
+	for _, window := range util.HashrateWindows {
+		m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "xmp_hashrate",
+			Help:        "Estimated hashrate of the proxy, in hashes per second",
+			ConstLabels: prometheus.Labels{"window": util.FormatWindow(window)},
+		}, func() float64 {
+			return p.totalHashrate.Hashrate(window)
+		}))
+	}
+
+	m.registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "xmp_shares_pending",
+			Help: "Shares awaiting a response from the pool",
+		}, func() float64 {
+			return float64(p.shareTracker.GetPendingCount())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "xmp_job_height",
+			Help: "Height of the current job",
+		}, func() float64 {
+			return float64(p.defaultSession.getJob().Height)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "xmp_job_difficulty",
+			Help: "Difficulty of the current job",
+		}, func() float64 {
+			return float64(p.defaultSession.getJob().Diff)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "xmp_upstream_connected",
+			Help: "1 if the proxy is connected to the pool",
+		}, func() float64 {
+			p.upstream.RLock()
+			defer p.upstream.RUnlock()
+			if p.upstream.Connected {
+				return 1
+			}
+			return 0
+		}),
+	)
+
+	return m
+}
+
+// records the time it took to notify all the miners of a job
+func (m *metrics) observeJobBroadcast(protocol string, job Job) {
+	m.jobBroadcast.WithLabelValues(protocol).Observe(time.Since(job.IssuedAt).Seconds())
+}
+
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,220 @@
+package proxy
+
+import (
+	"sort"
+	"sync"
+	"time"
+	"xelis-mining-proxy/util"
+)
+
+// Latency and reliability statistics of the pools
+
+// number of samples kept to compute the percentiles of the pool latencies
+const POOL_HEALTH_SAMPLES = 1000
+
+// PoolHealth measures the latency and reliability of a pool
+type PoolHealth struct {
+	Url string
+
+	FirstConnect   time.Time // first connection attempt
+	Connects       uint64
+	ConnectedSince time.Time // zero when disconnected
+	uptime         time.Duration
+
+	Jobs       uint64
+	Heights    uint64
+	lastJob    time.Time
+	lastHeight uint64
+
+	Accepted uint64
+	Rejected uint64
+	TimedOut uint64
+
+	roundTrips   *util.SampleWindow // share round trips, in milliseconds
+	broadcasts   *util.SampleWindow // time from job receipt to the last miner notified, in milliseconds
+	jobIntervals *util.SampleWindow // time between two jobs, in seconds
+
+	sync.Mutex
+}
+
+// Percentiles of a latency, in milliseconds
+type Percentiles struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+}
+
+func newPercentiles(w *util.SampleWindow) Percentiles {
+	p := w.Percentiles(50, 90, 99)
+	return Percentiles{p[0], p[1], p[2]}
+}
+
+// PoolHealthInfo describes the health of a pool
+type PoolHealthInfo struct {
+	Url         string  `json:"url"`
+	Connected   bool    `json:"connected"`
+	Uptime      float64 `json:"uptime"`       // seconds connected
+	UptimeRatio float64 `json:"uptime_ratio"` // percent of the time connected since the first connection attempt
+	Connects    uint64  `json:"connects"`
+	Reconnects  uint64  `json:"reconnects"`
+
+	Accepted    uint64      `json:"accepted"`
+	Rejected    uint64      `json:"rejected"`
+	TimedOut    uint64      `json:"timed_out"`
+	AcceptRatio float64     `json:"accept_ratio"` // percent
+	RoundTrip   Percentiles `json:"round_trip"`
+
+	Jobs          uint64      `json:"jobs"`
+	Heights       uint64      `json:"heights"`
+	JobsPerHeight float64     `json:"jobs_per_height"`
+	JobInterval   float64     `json:"job_interval"` // average, in seconds
+	JobBroadcast  Percentiles `json:"job_broadcast"`
+}
+
+func (p *Proxy) getPoolHealth(url string) *PoolHealth {
+	p.mutPoolHealth.Lock()
+	defer p.mutPoolHealth.Unlock()
+
+	h := p.poolHealth[url]
+	if h == nil {
+		h = &PoolHealth{
+			Url:          url,
+			roundTrips:   util.NewSampleWindow(POOL_HEALTH_SAMPLES),
+			broadcasts:   util.NewSampleWindow(POOL_HEALTH_SAMPLES),
+			jobIntervals: util.NewSampleWindow(POOL_HEALTH_SAMPLES),
+		}
+		p.poolHealth[url] = h
+	}
+	return h
+}
+
+func (h *PoolHealth) connecting() {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.FirstConnect.IsZero() {
+		h.FirstConnect = time.Now()
+	}
+}
+
+func (h *PoolHealth) connected() {
+	h.Lock()
+	defer h.Unlock()
+
+	h.Connects++
+	h.ConnectedSince = time.Now()
+}
+
+func (h *PoolHealth) disconnected() {
+	h.Lock()
+	defer h.Unlock()
+
+	if !h.ConnectedSince.IsZero() {
+		h.uptime += time.Since(h.ConnectedSince)
+		h.ConnectedSince = time.Time{}
+	}
+}
+
+func (h *PoolHealth) addJob(height uint64, t time.Time) {
+	h.Lock()
+	defer h.Unlock()
+
+	if !h.lastJob.IsZero() {
+		h.jobIntervals.Add(t.Sub(h.lastJob).Seconds())
+	}
+	h.lastJob = t
+	h.Jobs++
+	if height != h.lastHeight {
+		h.lastHeight = height
+		h.Heights++
+	}
+}
+
+func (h *PoolHealth) addBroadcast(d time.Duration) {
+	h.broadcasts.Add(float64(d.Microseconds()) / 1000)
+}
+
+func (h *PoolHealth) addShareResult(accepted bool, rtt time.Duration) {
+	h.Lock()
+	defer h.Unlock()
+
+	if accepted {
+		h.Accepted++
+	} else {
+		h.Rejected++
+	}
+	h.roundTrips.Add(float64(rtt.Microseconds()) / 1000)
+}
+
+func (h *PoolHealth) addTimeout() {
+	h.Lock()
+	defer h.Unlock()
+
+	h.TimedOut++
+}
+
+func (h *PoolHealth) Info() PoolHealthInfo {
+	h.Lock()
+	defer h.Unlock()
+
+	info := PoolHealthInfo{
+		Url:        h.Url,
+		Connected:  !h.ConnectedSince.IsZero(),
+		Connects:   h.Connects,
+		Reconnects: max(h.Connects, 1) - 1,
+		Accepted:   h.Accepted,
+		Rejected:   h.Rejected,
+		TimedOut:   h.TimedOut,
+		Jobs:       h.Jobs,
+		Heights:    h.Heights,
+	}
+
+	uptime := h.uptime
+	if info.Connected {
+		uptime += time.Since(h.ConnectedSince)
+	}
+	info.Uptime = uptime.Seconds()
+	if !h.FirstConnect.IsZero() {
+		info.UptimeRatio = uptime.Seconds() / time.Since(h.FirstConnect).Seconds() * 100
+	}
+	if total := h.Accepted + h.Rejected + h.TimedOut; total > 0 {
+		info.AcceptRatio = float64(h.Accepted) / float64(total) * 100
+	}
+	if h.Heights > 0 {
+		info.JobsPerHeight = float64(h.Jobs) / float64(h.Heights)
+	}
+	info.JobInterval = h.jobIntervals.Mean()
+	info.RoundTrip = newPercentiles(h.roundTrips)
+	info.JobBroadcast = newPercentiles(h.broadcasts)
+
+	return info
+}
+
+// returns the health of the pools, sorted by URL
+func (p *Proxy) listPoolHealth() []PoolHealthInfo {
+	p.mutPoolHealth.Lock()
+	list := make([]*PoolHealth, 0, len(p.poolHealth))
+	for _, h := range p.poolHealth {
+		list = append(list, h)
+	}
+	p.mutPoolHealth.Unlock()
+
+	infos := make([]PoolHealthInfo, 0, len(list))
+	for _, h := range list {
+		infos = append(infos, h.Info())
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Url < infos[j].Url
+	})
+	return infos
+}
+
+// logs a summary of the health of every pool
+func (p *Proxy) logPoolHealth() {
+	for _, h := range p.listPoolHealth() {
+		upstreamLog.Infof("Pool %s: uptime %.1f%%, %d reconnects, accepted %.1f%% | share RTT p50 %.0fms p90 %.0fms "+
+			"p99 %.0fms | job every %.1fs, %.2f jobs/height, broadcast p50 %.1fms p99 %.1fms", h.Url, h.UptimeRatio,
+			h.Reconnects, h.AcceptRatio, h.RoundTrip.P50, h.RoundTrip.P90, h.RoundTrip.P99, h.JobInterval,
+			h.JobsPerHeight, h.JobBroadcast.P50, h.JobBroadcast.P99)
+	}
+}
@@ -0,0 +1,289 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+	"xelis-mining-proxy/config"
+	"xelis-mining-proxy/journal"
+	"xelis-mining-proxy/log"
+	"xelis-mining-proxy/util"
+	"xelis-mining-proxy/webhook"
+)
+
+const VERSION = "1.1.0"
+
+// Job is a fast & efficient struct used for storing a job in memory
+type Job struct {
+	Blob       util.BlockMiner
+	Diff       uint64
+	Target     [32]byte
+	Height     uint64
+	TopoHeight uint64
+	Algorithm  string
+
+	UpstreamTimestamp uint64    // timestamp of the template received from the pool
+	IssuedAt          time.Time // when the job was last sent to the miners
+}
+
+// Options are the parameters of a new Proxy
+type Options struct {
+	// Config is the configuration of the proxy. It is normalized and validated by New.
+	Config Config
+
+	// DataDir is the directory of the state files: the learned workers (workers.json), the bans (bans.json) and
+	// the audit log when its path is relative. It is the current directory if empty.
+	DataDir string
+
+	// Events are the callbacks of the proxy events
+	Events Events
+
+	// SaveWallet saves a wallet address changed with the admin API to the configuration file, so that it isn't
+	// reverted when the configuration is reloaded. Without it, the change only lasts until the next reload.
+	SaveWallet func(wallet string) error
+}
+
+// Proxy is a mining proxy: it serves the stratum and getwork miners, and forwards their shares to the pool. All its
+// state, listeners and metrics belong to it, so several proxies can run in the same process.
+type Proxy struct {
+	dataDir    string
+	events     Events
+	saveWallet func(wallet string) error
+
+	// running configuration, read with getCfg
+	cfg    Config
+	mutCfg sync.RWMutex
+
+	startTime   time.Time
+	lastMinerID atomic.Uint64
+
+	// extra nonce suffixes of all the downstream miners
+	extraNonces *util.ExtraNonceAllocator
+
+	// the default session mines to the configured wallet, the sessions of the routed wallets are in sessions
+	defaultSession *Session
+	sessions       map[string]*Session
+	routeHints     map[string][]routeHint // see subscribeSession
+	mutSessions    sync.Mutex
+
+	// sessions of the split wallets, and their work when the split was configured
+	splitSessions map[string]*Session
+	splitBase     map[*Session]float64
+	mutSplit      sync.Mutex
+
+	stratumServer   *StratumServer
+	stratumListener *Listener
+
+	sockets         []*GetworkConn
+	socketsMut      sync.RWMutex
+	getworkListener *Listener
+
+	apiListener   *Listener
+	apiMux        *http.ServeMux
+	dashboard     *DashboardHub
+	dashboardOnce sync.Once
+
+	shareTracker *ShareTracker
+	shareJournal *journal.Journal // nil when the journal is disabled
+
+	upstream      *UpstreamState
+	jobHistory    []Job // recent jobs received from the pool, oldest first
+	mutJobHistory sync.RWMutex
+	poolHealth    map[string]*PoolHealth
+	mutPoolHealth sync.Mutex
+
+	// statistics of all the shares handled by the proxy, and number of rejected shares for each reason
+	totalStats       *ShareStats
+	rejectReasons    map[string]uint64
+	mutRejectReasons sync.Mutex
+
+	totalHashrate   *util.HashrateMeter
+	workerHashrates map[string]*util.HashrateMeter
+	walletHashrates map[string]*util.HashrateMeter
+	mutHashrates    sync.Mutex
+
+	workers        map[string]*WorkerState
+	workersDirty   bool // true if the learned workers changed since they were saved
+	workersSavedAt time.Time
+	mutWorkers     sync.Mutex
+
+	bannedIPs     map[string]bool
+	bannedWorkers map[string]bool
+	mutBans       sync.RWMutex
+
+	limits  *connLimits
+	metrics *metrics
+
+	// replaced when the webhooks are reconfigured
+	notifier atomic.Pointer[webhook.Notifier]
+	// true if upstream_disconnected was sent, and upstream_reconnected wasn't sent since
+	upstreamDownNotified bool
+	mutUpstreamDown      sync.Mutex
+
+	// true when the shares aren't forwarded to the pool
+	forwardingPaused atomic.Bool
+	mutAudit         sync.Mutex
+
+	eventQueue chan func()
+	eventsDone chan struct{} // closed at the end of the shutdown, once the last events are queued
+
+	started atomic.Bool
+	// true once the shutdown started: no new job is sent to the miners, and the configuration isn't reloaded
+	shuttingDown atomic.Bool
+	shutdownOnce sync.Once
+	done         chan struct{} // closed when the shutdown starts, stopping the background goroutines
+}
+
+// New creates a proxy with the given options. It returns an error if the configuration is invalid. The proxy
+// doesn't listen nor connect to the pool until it is started.
+func New(opts Options) (*Proxy, error) {
+	cfg := opts.Config
+	cfg.Normalize()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	lists, err := parseIPLists(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	dataDir := opts.DataDir
+	if dataDir == "" {
+		dataDir = "."
+	}
+
+	now := time.Now()
+	p := &Proxy{
+		dataDir:    dataDir,
+		events:     opts.Events,
+		saveWallet: opts.SaveWallet,
+		cfg:        cfg,
+		startTime:  now,
+
+		extraNonces: util.NewExtraNonceAllocator(config.EXTRANONCE_REUSE_TIMEOUT * time.Second),
+
+		sessions:      make(map[string]*Session),
+		routeHints:    make(map[string][]routeHint),
+		splitSessions: make(map[string]*Session),
+		splitBase:     make(map[*Session]float64),
+
+		stratumServer: &StratumServer{
+			Conns: make([]*StratumConn, 0),
+		},
+
+		poolHealth: make(map[string]*PoolHealth),
+
+		totalStats:    &ShareStats{},
+		rejectReasons: make(map[string]uint64),
+
+		totalHashrate:   util.NewHashrateMeterAt(now),
+		workerHashrates: make(map[string]*util.HashrateMeter),
+		walletHashrates: make(map[string]*util.HashrateMeter),
+
+		workers:       make(map[string]*WorkerState),
+		bannedIPs:     make(map[string]bool),
+		bannedWorkers: make(map[string]bool),
+
+		eventQueue: make(chan func(), EVENT_QUEUE_SIZE),
+		eventsDone: make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	p.defaultSession = newSession(p, "")
+	p.shareTracker = newShareTracker(p, 30*time.Second)
+	p.upstream = &UpstreamState{proxy: p}
+	p.dashboard = newDashboardHub(p)
+	p.metrics = newMetrics(p)
+	p.limits = newConnLimits(p.metrics.limitRefusals)
+	p.limits.setIPLists(lists)
+
+	p.stratumListener = newListener("stratum", p.serveStratum)
+	p.getworkListener = newListener("getwork", func(l net.Listener) {
+		err := http.Serve(l, http.HandlerFunc(p.wsHandler))
+		if !isListenerClosed(err) {
+			getworkLog.Err("getwork server stopped:", err)
+		}
+	})
+	p.apiMux = p.newApiMux()
+	p.apiListener = newListener("api", func(l net.Listener) {
+		err := http.Serve(l, p.apiMux)
+		if !isListenerClosed(err) {
+			log.Err("stats API stopped:", err)
+		}
+	})
+
+	return p, nil
+}
+
+// Start loads the state files, starts the stratum and getwork servers and the stats API, and connects to the pool.
+// It returns an error if a server can't listen on its port. The proxy runs until Shutdown is called, or until
+// ctx is done, which shuts it down waiting shutdown_timeout seconds for the pending shares.
+func (p *Proxy) Start(ctx context.Context) error {
+	if p.shuttingDown.Load() {
+		return errors.New("the proxy was shut down")
+	}
+	if !p.started.CompareAndSwap(false, true) {
+		return errors.New("the proxy was already started")
+	}
+	cfg := p.getCfg()
+
+	go p.dispatchEvents()
+	p.openJournal()
+	p.loadWorkers()
+	p.loadBans()
+
+	err := p.stratumListener.Bind(stratumAddr(cfg.StratumBindPort))
+	if err != nil {
+		p.closeJournal()
+		return fmt.Errorf("stratum server: %w", err)
+	}
+	stratumLog.Infof("Stratum server listening on port %d", cfg.StratumBindPort)
+
+	err = p.getworkListener.Bind(getworkAddr(cfg.GetworkBindPort))
+	if err != nil {
+		p.stratumListener.Close()
+		p.closeJournal()
+		return fmt.Errorf("getwork server: %w", err)
+	}
+	getworkLog.Info("Getwork server listening on port", cfg.GetworkBindPort)
+
+	p.startWebhooks()
+	p.configureWalletSplit()
+	p.listenApi()
+
+	go p.stratumPinger()
+	go p.jobRefresher()
+	go p.hashrateLogger()
+	go p.workerMonitor()
+	go p.splitRebalancer()
+
+	upstreamLog.Debug("getwork pool url", cfg.PoolUrl)
+	go p.defaultSession.run()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			timeout := time.Duration(p.getCfg().ShutdownTimeout) * time.Second
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			p.Shutdown(ctx)
+		case <-p.done:
+		}
+	}()
+	return nil
+}
+
+// returns a unique identifier for a new downstream miner
+func (p *Proxy) newMinerID() uint64 {
+	return p.lastMinerID.Add(1)
+}
+
+// returns the path of a state file in the data directory
+func (p *Proxy) dataPath(name string) string {
+	return filepath.Join(p.dataDir, name)
+}
@@ -0,0 +1,212 @@
+package proxy
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"xelis-mining-proxy/util"
+
+	"github.com/gorilla/websocket"
+)
+
+const TEST_WALLET = "xel:93uzjdrp9t2hhy7apcqjklrslu39r2eeg3dlw4kmu0pfxpy8xtkqqdl37gr"
+
+// starts a getwork pool that sends a job to every client, and keeps the connections open until they are closed
+func newTestPool(t *testing.T, height uint64) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	work := hex.EncodeToString(make([]byte, util.BLOCKMINER_LENGTH))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(
+			`{"new_job":{"difficulty":"1000","height":%d,"topoheight":%d,"miner_work":"%s","algorithm":"xel/v2"}}`,
+			height, height, work)))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// returns a port that is free to listen on
+func freePort(t *testing.T) uint16 {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	return uint16(l.Addr().(*net.TCPAddr).Port)
+}
+
+type testEvents struct {
+	jobs         chan JobEvent
+	connected    chan MinerEvent
+	disconnected chan MinerEvent
+}
+
+// creates a proxy mining to the pool, and records its events
+func newTestProxy(t *testing.T, pool *httptest.Server) (*Proxy, testEvents) {
+	ev := testEvents{
+		jobs:         make(chan JobEvent, 10),
+		connected:    make(chan MinerEvent, 10),
+		disconnected: make(chan MinerEvent, 10),
+	}
+
+	cfg := DefaultConfig()
+	cfg.WalletAddress = TEST_WALLET
+	cfg.PoolUrl = strings.TrimPrefix(pool.URL, "http://")
+	cfg.PoolProtocol = "getwork"
+	cfg.StratumBindPort = freePort(t)
+	cfg.GetworkBindPort = freePort(t)
+	cfg.LearnWorkers = false
+	cfg.AdminAuditLog = ""
+
+	p, err := New(Options{
+		Config:  cfg,
+		DataDir: t.TempDir(),
+		Events: Events{
+			OnJob:               func(e JobEvent) { ev.jobs <- e },
+			OnMinerConnected:    func(e MinerEvent) { ev.connected <- e },
+			OnMinerDisconnected: func(e MinerEvent) { ev.disconnected <- e },
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, ev
+}
+
+func receive[T any](t *testing.T, c chan T) T {
+	t.Helper()
+
+	select {
+	case e := <-c:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+		panic("unreachable")
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	_, err := New(Options{Config: DefaultConfig()})
+	if err == nil || !strings.Contains(err.Error(), "wallet") {
+		t.Errorf("New with the default wallet returned %v; want a wallet error", err)
+	}
+}
+
+func TestTwoProxies(t *testing.T) {
+	proxies := make([]*Proxy, 2)
+	events := make([]testEvents, 2)
+	for i := range proxies {
+		proxies[i], events[i] = newTestProxy(t, newTestPool(t, uint64(100+i)))
+
+		if err := proxies[i].Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, p := range proxies {
+		if job := receive(t, events[i].jobs); job.Height != uint64(100+i) || job.Wallet != TEST_WALLET {
+			t.Errorf("proxy %d: unexpected job %+v", i, job)
+		}
+
+		url := fmt.Sprintf("ws://127.0.0.1:%d/getwork/%s/rig%d", p.Config().GetworkBindPort, TEST_WALLET, i)
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var msg map[string]map[string]any
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if height := msg["new_job"]["height"]; height != float64(100+i) {
+			t.Errorf("proxy %d: miner got a job at height %v; want %d", i, height, 100+i)
+		}
+
+		e := receive(t, events[i].connected)
+		if e.ID != 1 || e.Protocol != "getwork" || e.Worker != fmt.Sprint("rig", i) || e.Wallet != TEST_WALLET {
+			t.Errorf("proxy %d: unexpected connection event %+v", i, e)
+		}
+		if n := len(p.Miners()); n != 1 {
+			t.Errorf("proxy %d: %d miners; want 1", i, n)
+		}
+
+		conn.Close()
+		if e := receive(t, events[i].disconnected); e.Worker != fmt.Sprint("rig", i) {
+			t.Errorf("proxy %d: unexpected disconnection event %+v", i, e)
+		}
+	}
+
+	for i, p := range proxies {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := p.Shutdown(ctx); err != nil {
+			t.Errorf("proxy %d: shutdown: %v", i, err)
+		}
+		cancel()
+
+		if err := p.Start(context.Background()); err == nil {
+			t.Errorf("proxy %d: started after the shutdown", i)
+		}
+	}
+}
+
+func TestShareRefusedDuringShutdown(t *testing.T) {
+	p, events := newTestProxy(t, newTestPool(t, 100))
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, events.jobs)
+
+	url := fmt.Sprintf("ws://127.0.0.1:%d/getwork/%s/rig", p.Config().GetworkBindPort, TEST_WALLET)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var job map[string]map[string]any
+	if err := conn.ReadJSON(&job); err != nil {
+		t.Fatal(err)
+	}
+
+	// the listeners are closed and the pending shares drained, while the miner is still connected
+	p.shuttingDown.Store(true)
+
+	if err := conn.WriteJSON(map[string]any{"miner_work": job["new_job"]["miner_work"]}); err != nil {
+		t.Fatal(err)
+	}
+	var res map[string]string
+	if err := conn.ReadJSON(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res["block_rejected"] != "proxy shutting down" {
+		t.Errorf("share answered with %v; want a rejection", res)
+	}
+	if n := p.shareTracker.GetPendingCount(); n != 0 {
+		t.Errorf("%d pending shares; want 0", n)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"xelis-mining-proxy/log"
+)
+
+// Configuration reload: applies a new configuration to the running proxy
+
+// fields that are only applied when the proxy starts
+var restartFields = []string{"journal_dir", "journal_max_age", "journal_max_size", "learn_workers"}
+
+var upstreamFields = []string{"wallet", "pool_url", "pool_protocol"}
+
+var webhookFields = []string{"webhooks", "webhook_debounce", "webhook_retries"}
+
+func changed(fields []string, names ...string) bool {
+	for _, name := range names {
+		if slices.Contains(fields, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload applies a new configuration without restarting the proxy. It returns an error, keeping the running
+// configuration, if the new one is invalid or a server can't listen on its new port. The logging fields are left to
+// the caller, and the share journal and learn_workers are only applied when the proxy starts.
+func (p *Proxy) Reload(c Config) error {
+	if p.shuttingDown.Load() {
+		return errors.New("the proxy is shutting down")
+	}
+
+	c.Normalize()
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	lists, err := parseIPLists(c)
+	if err != nil {
+		return err
+	}
+
+	old := p.getCfg()
+	fields, _ := Diff(old, c)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	// move the listeners first: if a port can't be used, the running configuration is kept
+	if p.started.Load() {
+		if changed(fields, "stratum_bind_port") {
+			err := p.stratumListener.Bind(stratumAddr(c.StratumBindPort))
+			if err != nil {
+				return fmt.Errorf("stratum_bind_port: %w", err)
+			}
+		}
+		if changed(fields, "getwork_bind_port") {
+			err := p.getworkListener.Bind(getworkAddr(c.GetworkBindPort))
+			if err != nil {
+				p.stratumListener.Bind(stratumAddr(old.StratumBindPort))
+				return fmt.Errorf("getwork_bind_port: %w", err)
+			}
+		}
+	}
+
+	p.mutCfg.Lock()
+	p.cfg = c
+	p.mutCfg.Unlock()
+
+	p.limits.setIPLists(lists)
+
+	if changed(fields, "expected_workers") {
+		p.setExpectedWorkers(c.ExpectedWorkers)
+	}
+	if !p.started.Load() {
+		return nil
+	}
+
+	if changed(fields, "api_bind_address") {
+		p.listenApi()
+	}
+	if changed(fields, webhookFields...) {
+		p.configureWebhooks()
+	}
+	if changed(fields, upstreamFields...) {
+		p.reconnectPool()
+	}
+	if changed(fields, "wallet_split") {
+		p.configureWalletSplit()
+	}
+	for _, f := range fields {
+		if slices.Contains(restartFields, f) {
+			log.Warnf("%s changed, restart the proxy to apply it", f)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,368 @@
+package proxy
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+	"xelis-mining-proxy/getwork"
+	"xelis-mining-proxy/stratum"
+)
+
+// Upstream sessions: with wallet routing, the miners authorized with the same wallet share a pool connection
+// mining to that wallet. The other miners use the default session, mining to the configured wallet.
+
+// delay after which the session of a wallet without miners is closed
+const SESSION_IDLE_TIMEOUT = time.Minute
+
+// maximum time waited for the first job of a new session before answering a miner
+const SESSION_JOB_WAIT = 5 * time.Second
+
+// values of unknown_wallet
+const (
+	UNKNOWN_WALLET_DEFAULT = "default"
+	UNKNOWN_WALLET_REFUSE  = "refuse"
+)
+
+// Session is a connection to the pool mining to one wallet
+type Session struct {
+	Wallet string // empty for the default session, which mines to the configured wallet
+
+	proxy *Proxy
+
+	client  *getwork.Getwork
+	shares  chan Share
+	pending chan string // FIFO queue of share IDs in submission order
+
+	job       Job
+	ready     chan struct{} // closed when the first job is received
+	done      chan struct{} // closed when the session is closed
+	miners    int
+	idleSince time.Time
+	closed    bool
+
+	work float64 // difficulty of the accepted shares
+
+	sync.RWMutex
+}
+
+func newSession(p *Proxy, wallet string) *Session {
+	return &Session{
+		Wallet: wallet,
+		proxy:  p,
+		shares: make(chan Share, 1),
+		ready:  make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// returns the default session followed by the sessions of the routed wallets
+func (p *Proxy) listSessions() []*Session {
+	p.mutSessions.Lock()
+	defer p.mutSessions.Unlock()
+
+	list := []*Session{p.defaultSession}
+	for _, s := range p.sessions {
+		list = append(list, s)
+	}
+	return list
+}
+
+func (s *Session) isDefault() bool {
+	return s.Wallet == ""
+}
+
+// returns the wallet address mined by the session
+func (s *Session) wallet(cfg Config) string {
+	if s.isDefault() {
+		return cfg.WalletAddress
+	}
+	return s.Wallet
+}
+
+func (s *Session) isClosed() bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.closed
+}
+
+// marks the session as closed, so it doesn't reconnect and stops accepting shares. The caller must hold the lock.
+func (s *Session) markClosed() {
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+}
+
+func (s *Session) setClient(c *getwork.Getwork) {
+	s.Lock()
+	defer s.Unlock()
+
+	// the session was closed while connecting
+	if s.closed && c != nil {
+		c.Close()
+	}
+	s.client = c
+}
+
+// closes the pool connection of the session, which then reconnects unless the session is closed
+func (s *Session) disconnect() {
+	s.RLock()
+	c := s.client
+	s.RUnlock()
+
+	if c != nil {
+		c.Close()
+	}
+}
+
+// returns the current job of the session
+func (s *Session) getJob() Job {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.job
+}
+
+// sets the current job of the session, and returns the previous one
+func (s *Session) setJob(job Job) Job {
+	s.Lock()
+	defer s.Unlock()
+
+	prev := s.job
+	s.job = job
+	if prev.Diff == 0 && job.Diff != 0 {
+		close(s.ready)
+	}
+	return prev
+}
+
+// modifies the current job of the session if update returns true, and returns the job
+func (s *Session) updateJob(update func(job *Job) bool) (Job, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	j := s.job
+	if !update(&j) {
+		return j, false
+	}
+	s.job = j
+	return j, true
+}
+
+// returns the current job of the session, waiting for the first job of a new session at most the given time
+func (s *Session) waitJob(timeout time.Duration) Job {
+	select {
+	case <-s.ready:
+	case <-time.After(timeout):
+	}
+	return s.getJob()
+}
+
+// adds the difficulty of an accepted share to the work of the session
+func (s *Session) addWork(work float64) {
+	if s == nil {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.work += work
+}
+
+func (s *Session) getWork() float64 {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.work
+}
+
+// queues a share to be sent to the pool. The connection loop of a closed session doesn't read the queue anymore, so
+// the share is rejected instead of blocking the miner forever.
+func (s *Session) submit(share Share) {
+	select {
+	case s.shares <- share:
+	case <-s.done:
+		if pending := s.proxy.shareTracker.GetPendingShare(share.ID); pending != nil {
+			pending.ResponseChan <- ShareResult{
+				Accepted: false,
+				Error: &stratum.Error{
+					Code:    -1,
+					Message: "pool session closed",
+				},
+				Reason: "session_closed",
+			}
+		}
+	}
+}
+
+// returns the number of shares waiting to be sent to the pool
+func (s *Session) pendingShares() int {
+	return len(s.shares)
+}
+
+// returns the session of a routed wallet with one more miner, starting it if needed
+func (p *Proxy) acquireSession(wallet string) *Session {
+	if wallet == "" {
+		return p.defaultSession
+	}
+
+	p.mutSessions.Lock()
+	defer p.mutSessions.Unlock()
+
+	s, ok := p.sessions[wallet]
+	if !ok {
+		upstreamLog.Info("Opening a new pool session for wallet", wallet)
+		s = newSession(p, wallet)
+		p.sessions[wallet] = s
+		go s.run()
+	}
+
+	s.Lock()
+	s.miners++
+	s.Unlock()
+	return s
+}
+
+// removes a miner from the session, which is closed after SESSION_IDLE_TIMEOUT without miners
+func (s *Session) release() {
+	if s == nil || s.isDefault() {
+		return
+	}
+
+	s.Lock()
+	s.miners--
+	idle := s.miners == 0
+	if idle {
+		s.idleSince = time.Now()
+	}
+	s.Unlock()
+
+	if idle {
+		time.AfterFunc(SESSION_IDLE_TIMEOUT, s.closeIfIdle)
+	}
+}
+
+func (s *Session) closeIfIdle() {
+	p := s.proxy
+	p.mutSessions.Lock()
+	defer p.mutSessions.Unlock()
+
+	s.Lock()
+	if s.miners > 0 || s.closed || time.Since(s.idleSince) < SESSION_IDLE_TIMEOUT {
+		s.Unlock()
+		return
+	}
+	s.markClosed()
+	s.Unlock()
+
+	upstreamLog.Info("Closing the idle pool session of wallet", s.Wallet)
+	delete(p.sessions, s.Wallet)
+	for key, hints := range p.routeHints {
+		hints = slices.DeleteFunc(hints, func(h routeHint) bool { return h.wallet == s.Wallet })
+		if len(hints) == 0 {
+			delete(p.routeHints, key)
+		} else {
+			p.routeHints[key] = hints
+		}
+	}
+	s.disconnect()
+}
+
+var errWalletRefused = errors.New("wallet not allowed")
+
+// returns the wallet of the session a miner authorized with the given wallet is routed to, empty for the default
+// session. It returns errWalletRefused if the wallet isn't routed and unknown wallets are refused.
+func (p *Proxy) routeWallet(wallet string) (string, error) {
+	cfg := p.getCfg()
+	if !cfg.WalletRouting || wallet == cfg.WalletAddress {
+		return "", nil
+	}
+
+	routed := ValidateAddress(wallet, cfg.Network) == nil &&
+		(len(cfg.RoutedWallets) == 0 || slices.Contains(cfg.RoutedWallets, wallet))
+	if routed {
+		return wallet, nil
+	}
+	if cfg.UnknownWallet == UNKNOWN_WALLET_REFUSE {
+		return "", errWalletRefused
+	}
+	return "", nil
+}
+
+// routeHint is the wallet of the session a stratum miner was asked to reconnect to, to get its public key
+type routeHint struct {
+	session string // stratum session ID of the miner
+	wallet  string // empty for the default session
+	created time.Time
+}
+
+// returns the session whose public key is sent to a subscribing stratum miner: the session of its wallet if it
+// was asked to reconnect to get it, the session chosen by the wallet split otherwise.
+// The hints are kept by extra nonce key, which is shared by the rigs behind the same address with the same agent,
+// so a miner resuming its stratum session uses the hint of that session. The other miners use the oldest hint of
+// their key. A hint is only used once.
+func (p *Proxy) subscribeSession(key, session string) *Session {
+	p.mutSessions.Lock()
+	hints := p.routeHints[key]
+	i := slices.IndexFunc(hints, func(h routeHint) bool {
+		return time.Since(h.created) < ROUTE_HINT_TIMEOUT && (session == "" || h.session == session)
+	})
+	var wallet string
+	if i >= 0 {
+		wallet = hints[i].wallet
+		p.removeRouteHint(key, i)
+	}
+	s, ok := p.sessions[wallet]
+	p.mutSessions.Unlock()
+
+	if i >= 0 && wallet == "" {
+		return p.defaultSession
+	}
+	if ok {
+		return s
+	}
+	return p.splitSession(nil)
+}
+
+// maximum time a stratum miner asked to reconnect has to subscribe again to use its route hint
+const ROUTE_HINT_TIMEOUT = time.Minute
+
+// sets the wallet of the session of a stratum miner which is asked to reconnect to get its public key. An empty
+// wallet is the default session.
+func (p *Proxy) setRouteHint(key, session, wallet string) {
+	p.mutSessions.Lock()
+	defer p.mutSessions.Unlock()
+
+	hints := slices.DeleteFunc(p.routeHints[key], func(h routeHint) bool {
+		return h.session == session || time.Since(h.created) >= ROUTE_HINT_TIMEOUT
+	})
+	p.routeHints[key] = append(hints, routeHint{
+		session: session,
+		wallet:  wallet,
+		created: time.Now(),
+	})
+}
+
+// removes the i-th route hint of a key. mutSessions MUST be locked before calling this
+func (p *Proxy) removeRouteHint(key string, i int) {
+	hints := slices.Delete(p.routeHints[key], i, i+1)
+	if len(hints) == 0 {
+		delete(p.routeHints, key)
+	} else {
+		p.routeHints[key] = hints
+	}
+}
+
+// closes the pool connections of all the sessions, which don't reconnect
+func (p *Proxy) closeSessions() {
+	for _, s := range p.listSessions() {
+		s.Lock()
+		s.markClosed()
+		s.Unlock()
+
+		s.disconnect()
+	}
+}
@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubmitToClosedSession(t *testing.T) {
+	p, _ := newTestProxy(t, newTestPool(t, 100))
+	s := newSession(p, TEST_WALLET)
+
+	// fills the queue, as if the connection loop had exited
+	s.shares <- Share{ID: "queued"}
+
+	pending := &PendingShare{
+		ID:           "share",
+		SubmittedAt:  time.Now(),
+		ResponseChan: make(chan ShareResult, 1),
+	}
+	p.shareTracker.AddPendingShare(pending.ID, pending)
+
+	s.Lock()
+	s.markClosed()
+	s.markClosed()
+	s.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.submit(Share{ID: pending.ID})
+		close(done)
+	}()
+	receive(t, done)
+
+	if res := receive(t, pending.ResponseChan); res.Accepted || res.Reason != "session_closed" {
+		t.Errorf("share submitted to a closed session answered with %+v; want a rejection", res)
+	}
+}
+
+func TestRouteHints(t *testing.T) {
+	p, _ := newTestProxy(t, newTestPool(t, 100))
+	routed := newSession(p, TEST_OTHER_WALLET)
+	p.sessions[routed.Wallet] = routed
+
+	// three rigs behind the same address, with the same agent, were asked to reconnect
+	const key = "stratum/203.0.113.7/xelis-miner"
+	p.setRouteHint(key, "rig1", routed.Wallet)
+	p.setRouteHint(key, "rig2", "")
+	p.setRouteHint(key, "rig3", routed.Wallet)
+
+	if s := p.subscribeSession(key, "rig2"); s != p.defaultSession {
+		t.Errorf("resumed session rig2 got the session of %q; want the default session", s.Wallet)
+	}
+	if s := p.subscribeSession(key, ""); s != routed {
+		t.Errorf("miner without session ID got the session of %q; want the oldest hint", s.Wallet)
+	}
+	if s := p.subscribeSession(key, "rig1"); s != p.defaultSession {
+		t.Errorf("hint of rig1 used twice, got the session of %q", s.Wallet)
+	}
+	if s := p.subscribeSession(key, "rig3"); s != routed {
+		t.Errorf("resumed session rig3 got the session of %q; want the routed session", s.Wallet)
+	}
+	if n := len(p.routeHints); n != 0 {
+		t.Errorf("%d route hint keys left; want 0", n)
+	}
+}
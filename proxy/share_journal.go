@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"path/filepath"
+	"time"
+	"xelis-mining-proxy/journal"
+	"xelis-mining-proxy/log"
+)
+
+// Persistent share journal
+
+// returns the directory of the share journal, relative paths being in the data directory
+func (p *Proxy) journalDir() string {
+	dir := p.getCfg().JournalDir
+	if dir == "" || filepath.IsAbs(dir) {
+		return dir
+	}
+	return p.dataPath(dir)
+}
+
+func (p *Proxy) openJournal() {
+	cfg := p.getCfg()
+	dir := p.journalDir()
+	if dir == "" {
+		return
+	}
+
+	j, err := journal.Open(dir, time.Duration(cfg.JournalMaxAge)*24*time.Hour,
+		int64(cfg.JournalMaxSize)*1024*1024)
+	if err != nil {
+		log.Err("failed to open the share journal:", err)
+		return
+	}
+	p.shareJournal = j
+	log.Info("Writing share journal to", dir)
+}
+
+func (p *Proxy) closeJournal() {
+	if p.shareJournal != nil {
+		p.shareJournal.Close()
+	}
+}
+
+func (p *Proxy) journalEvent(e journal.Entry) {
+	if p.shareJournal != nil {
+		p.shareJournal.Append(e)
+	}
+}
+
+// records an event of a pending share in the journal
+func (p *Proxy) journalShare(event string, ps *PendingShare, reason string) {
+	if p.shareJournal == nil {
+		return
+	}
+
+	e := journal.Entry{
+		Event:      event,
+		Protocol:   ps.Protocol(),
+		Miner:      ps.MinerIP(),
+		Worker:     ps.Worker,
+		Wallet:     ps.Wallet,
+		Share:      ps.ID,
+		Height:     ps.Height,
+		Difficulty: ps.Difficulty,
+		Reason:     reason,
+	}
+	switch event {
+	case journal.EventAccepted, journal.EventRejected, journal.EventTimedOut:
+		e.RoundTrip = float64(time.Since(ps.SubmittedAt).Microseconds()) / 1000
+	}
+	p.shareJournal.Append(e)
+}
+
+// records an event of a share that was refused before being forwarded to the pool, and reports it to the share
+// callback
+func (p *Proxy) journalRefused(event, protocol, miner, worker, wallet string, job PastJob, reason string) {
+	p.journalEvent(journal.Entry{
+		Event:      event,
+		Protocol:   protocol,
+		Miner:      miner,
+		Worker:     worker,
+		Wallet:     wallet,
+		Height:     job.Height,
+		Difficulty: job.Diff,
+		Reason:     reason,
+	})
+	p.shareEvent(ShareEvent{
+		Protocol:   protocol,
+		IP:         miner,
+		Worker:     worker,
+		Wallet:     wallet,
+		Height:     job.Height,
+		Difficulty: job.Diff,
+		Reason:     reason,
+	})
+}
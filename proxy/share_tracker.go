@@ -0,0 +1,346 @@
+package proxy
+
+import (
+	"context"
+	"encoding/hex"
+	"sync"
+	"time"
+	"xelis-mining-proxy/journal"
+	"xelis-mining-proxy/log"
+	"xelis-mining-proxy/stratum"
+	"xelis-mining-proxy/util"
+
+	"github.com/gorilla/websocket"
+)
+
+var trackerLog = log.Component("tracker")
+
+// PendingShare represents a share waiting for pool response
+type PendingShare struct {
+	ID           string       // Share ID: hex(extra_nonce + nonce)
+	RequestID    interface{}  // Stratum request ID to respond with (nil for getwork)
+	StratumConn  *StratumConn // Stratum connection to send response to (nil for getwork)
+	GetworkConn  *GetworkConn // Getwork connection to send response to (nil for stratum)
+	SubmittedAt  time.Time    // When the share was submitted
+	ResponseChan chan ShareResult
+	CancelFunc   context.CancelFunc // To cancel the timeout goroutine
+
+	Difficulty         uint64   // Difficulty assigned to the miner
+	AchievedDifficulty uint64   // Difficulty reached by the share, at least Difficulty
+	Height             uint64   // Height of the job the share was found for
+	Wallet             string   // Wallet of the miner
+	Worker             string   // Worker name of the miner, or its IP
+	Session            *Session // upstream session the share was sent to
+}
+
+// returns the protocol of the miner that submitted the share
+func (p *PendingShare) Protocol() string {
+	if p.StratumConn != nil {
+		return "stratum"
+	}
+	return "getwork"
+}
+
+// returns the IP of the miner that submitted the share
+func (p *PendingShare) MinerIP() string {
+	if p.StratumConn != nil {
+		return p.StratumConn.IP
+	}
+	return util.RemovePort(p.GetworkConn.IP())
+}
+
+// returns the hashrate meter of the miner that submitted the share
+func (p *PendingShare) Hashrate() *util.HashrateMeter {
+	if p.StratumConn != nil {
+		return p.StratumConn.Hashrate
+	}
+	return p.GetworkConn.Hashrate
+}
+
+// returns the statistics of the miner that submitted the share
+func (p *PendingShare) Stats() *ShareStats {
+	if p.StratumConn != nil {
+		return &p.StratumConn.Stats
+	}
+	return &p.GetworkConn.Stats
+}
+
+// returns the event of the share, without its result
+func (p *PendingShare) event() ShareEvent {
+	return ShareEvent{
+		Protocol:   p.Protocol(),
+		IP:         p.MinerIP(),
+		Worker:     p.Worker,
+		Wallet:     p.Wallet,
+		Height:     p.Height,
+		Difficulty: p.Difficulty,
+	}
+}
+
+// records the result of the share in the miner and proxy statistics
+func (p *Proxy) recordResult(ps *PendingShare, result ShareResult) {
+	rtt := time.Since(ps.SubmittedAt)
+	p.metrics.shareRoundTrip.WithLabelValues(ps.Protocol()).Observe(rtt.Seconds())
+	p.upstream.health().addShareResult(result.Accepted, rtt)
+
+	e := ps.event()
+	e.Accepted = result.Accepted
+	e.RoundTrip = rtt
+
+	if result.Accepted {
+		ps.Stats().AddAccepted(ps.Difficulty, ps.AchievedDifficulty)
+		p.totalStats.AddAccepted(ps.Difficulty, ps.AchievedDifficulty)
+		p.metrics.sharesAccepted.WithLabelValues(ps.Protocol()).Inc()
+		ps.Hashrate().Add(float64(ps.Difficulty))
+		p.addHashrateWork(ps.Worker, ps.Wallet, float64(ps.Difficulty))
+		p.workerShare(ps.Worker)
+		ps.Session.addWork(float64(ps.Difficulty))
+		p.journalShare(journal.EventAccepted, ps, "")
+		p.shareEvent(e)
+		if p.getCfg().Solo {
+			p.notifyBlockFound(ps, e)
+		}
+	} else {
+		ps.Stats().AddRejected()
+		p.totalStats.AddRejected()
+		p.metrics.sharesRejected.WithLabelValues(ps.Protocol(), result.Reason).Inc()
+		if result.Error != nil {
+			p.addRejectReason(result.Error.Message)
+		} else {
+			p.addRejectReason(result.Reason)
+		}
+		p.journalShare(journal.EventRejected, ps, result.Reason)
+		e.Reason = result.Reason
+		p.shareEvent(e)
+	}
+}
+
+// records a share that the pool didn't answer in time
+func (p *Proxy) recordTimeout(ps *PendingShare) {
+	ps.Stats().AddRejected()
+	p.totalStats.AddRejected()
+	p.metrics.sharesTimedOut.WithLabelValues(ps.Protocol()).Inc()
+	p.upstream.health().addTimeout()
+	p.addRejectReason("pool response timeout")
+	p.journalShare(journal.EventTimedOut, ps, "timeout")
+
+	e := ps.event()
+	e.Reason = "timeout"
+	p.shareEvent(e)
+}
+
+// ShareResult contains the pool's response for a share
+type ShareResult struct {
+	Accepted bool
+	Error    *stratum.Error
+	Reason   string // Short rejection reason, used as metrics label
+}
+
+// ShareTracker manages pending shares awaiting pool responses
+type ShareTracker struct {
+	proxy *Proxy
+
+	mu            sync.RWMutex
+	pendingShares map[string]*PendingShare // Key: hex(extra_nonce + nonce)
+	recentShares  map[string]time.Time     // Shares submitted recently, used to detect duplicates
+	lastCleanup   time.Time
+	timeout       time.Duration
+}
+
+// how long submitted share IDs are remembered to detect duplicates
+const DUPLICATE_WINDOW = 10 * time.Minute
+
+// creates a share tracker of the proxy with the specified timeout
+func newShareTracker(p *Proxy, timeout time.Duration) *ShareTracker {
+	return &ShareTracker{
+		proxy:         p,
+		pendingShares: make(map[string]*PendingShare),
+		recentShares:  make(map[string]time.Time),
+		lastCleanup:   time.Now(),
+		timeout:       timeout,
+	}
+}
+
+// GenerateShareID creates a unique share ID from extra nonce and nonce
+// This is guaranteed unique because extra nonce is unique per miner connection
+// and nonce is unique per share attempt from that miner
+func GenerateShareID(extraNonce [32]byte, nonce [8]byte) string {
+	// Concatenate extra nonce (32 bytes) + nonce (8 bytes) = 40 bytes
+	combined := make([]byte, 40)
+	copy(combined[0:32], extraNonce[:])
+	copy(combined[32:40], nonce[:])
+	return hex.EncodeToString(combined)
+}
+
+// ExtractShareID extracts the share ID from a complete block (112 bytes)
+// Block structure: workhash(32) + timestamp(8) + nonce(8) + extra_nonce(32) + pubkey(32)
+func ExtractShareID(block []byte) (string, error) {
+	if len(block) != 112 {
+		trackerLog.Warnf("ExtractShareID: block length %d != 112", len(block))
+		return "", nil
+	}
+
+	// Extract nonce (bytes 40-48) and extra nonce (bytes 48-80)
+	nonce := [8]byte(block[40:48])
+	extraNonce := [32]byte(block[48:80])
+
+	return GenerateShareID(extraNonce, nonce), nil
+}
+
+// validateShare checks a submitted BlockMiner against the BlockMiner issued to the miner, allowing the
+// configured timestamp drift
+func (p *Proxy) validateShare(submitted, issued util.BlockMiner) error {
+	return util.ValidateSubmission(submitted, issued, uint64(time.Now().UnixMilli()), p.getCfg().TimestampDrift*1000)
+}
+
+// AddPendingShare registers a share awaiting pool response
+func (st *ShareTracker) AddPendingShare(shareID string, pending *PendingShare) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.pendingShares[shareID] = pending
+	st.recentShares[shareID] = pending.SubmittedAt
+
+	if time.Since(st.lastCleanup) > time.Minute {
+		for k, v := range st.recentShares {
+			if time.Since(v) > DUPLICATE_WINDOW {
+				delete(st.recentShares, k)
+			}
+		}
+		st.lastCleanup = time.Now()
+	}
+	trackerLog.Share(shareID).Debugf("Added pending share %s (total pending: %d)", shareID, len(st.pendingShares))
+}
+
+// RemovePendingShare removes a share from tracking
+func (st *ShareTracker) RemovePendingShare(shareID string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if pending, exists := st.pendingShares[shareID]; exists {
+		// Cancel the timeout goroutine if it exists
+		if pending.CancelFunc != nil {
+			pending.CancelFunc()
+		}
+		delete(st.pendingShares, shareID)
+		trackerLog.Share(shareID).Debugf("Removed pending share %s (total pending: %d)", shareID, len(st.pendingShares))
+	}
+}
+
+// IsDuplicate returns true if a share with the same ID was submitted recently
+func (st *ShareTracker) IsDuplicate(shareID string) bool {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	if _, ok := st.pendingShares[shareID]; ok {
+		return true
+	}
+	t, ok := st.recentShares[shareID]
+	return ok && time.Since(t) < DUPLICATE_WINDOW
+}
+
+// GetPendingShare retrieves a pending share by ID
+func (st *ShareTracker) GetPendingShare(shareID string) *PendingShare {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	return st.pendingShares[shareID]
+}
+
+// StartResponseWaiter starts a goroutine that waits for pool response or timeout
+func (st *ShareTracker) StartResponseWaiter(shareID string, pending *PendingShare) {
+	ctx, cancel := context.WithTimeout(context.Background(), st.timeout)
+	pending.CancelFunc = cancel
+
+	shareLog := trackerLog.Share(shareID).Height(pending.Height)
+
+	go func() {
+		defer cancel()
+		defer st.RemovePendingShare(shareID)
+
+		select {
+		case result := <-pending.ResponseChan:
+			// Got pool response - send to miner based on connection type
+			shareLog.Debugf("Share %s: sending result (accepted=%v) to miner", shareID, result.Accepted)
+			st.proxy.recordResult(pending, result)
+
+			if pending.StratumConn != nil {
+				// Stratum response
+				pending.StratumConn.Lock()
+				defer pending.StratumConn.Unlock()
+
+				if !pending.StratumConn.Alive {
+					shareLog.Debugf("Share %s: stratum connection closed, skipping response", shareID)
+					return
+				}
+
+				err := pending.StratumConn.WriteJSON(stratum.ResponseOut{
+					Id:     pending.RequestID.(uint32),
+					Result: result.Accepted,
+					Error:  result.Error,
+				})
+				if err != nil {
+					shareLog.Warnf("Share %s: failed to send stratum response: %v", shareID, err)
+				}
+			} else if pending.GetworkConn != nil {
+				// Getwork response
+				pending.GetworkConn.Lock()
+				defer pending.GetworkConn.Unlock()
+
+				var msg string
+				if result.Accepted {
+					msg = `"block_accepted"`
+				} else {
+					msg = `"block_rejected"`
+				}
+
+				err := pending.GetworkConn.conn.WriteMessage(websocket.TextMessage, []byte(msg))
+				if err != nil {
+					shareLog.Warnf("Share %s: failed to send getwork response: %v", shareID, err)
+				}
+			}
+
+		case <-ctx.Done():
+			// Timeout - send rejection to miner
+			shareLog.Warnf("Share %s timed out after %v waiting for pool response", shareID, st.timeout)
+			st.proxy.recordTimeout(pending)
+
+			if pending.StratumConn != nil {
+				pending.StratumConn.Lock()
+				defer pending.StratumConn.Unlock()
+
+				if !pending.StratumConn.Alive {
+					shareLog.Debugf("Share %s: stratum connection closed during timeout", shareID)
+					return
+				}
+
+				err := pending.StratumConn.WriteJSON(stratum.ResponseOut{
+					Id:     pending.RequestID.(uint32),
+					Result: false,
+					Error: &stratum.Error{
+						Code:    -1,
+						Message: "pool response timeout",
+					},
+				})
+				if err != nil {
+					shareLog.Warnf("Share %s: failed to send timeout response: %v", shareID, err)
+				}
+			} else if pending.GetworkConn != nil {
+				pending.GetworkConn.Lock()
+				defer pending.GetworkConn.Unlock()
+
+				err := pending.GetworkConn.conn.WriteMessage(websocket.TextMessage, []byte(`"block_rejected"`))
+				if err != nil {
+					shareLog.Warnf("Share %s: failed to send getwork timeout response: %v", shareID, err)
+				}
+			}
+		}
+	}()
+}
+
+// GetPendingCount returns the number of shares awaiting responses
+func (st *ShareTracker) GetPendingCount() int {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	return len(st.pendingShares)
+}
@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"context"
+	"time"
+	"xelis-mining-proxy/log"
+	"xelis-mining-proxy/util"
+)
+
+// Graceful shutdown: stops accepting miners and shares and issuing jobs, waits for the pending shares, then
+// disconnects the miners and flushes the state
+
+// interval at which the pending shares are checked during the shutdown
+const SHUTDOWN_POLL_INTERVAL = 100 * time.Millisecond
+
+// Shutdown stops accepting miners, shares and sending jobs, and waits until the pool answered the pending shares
+// or ctx is done. It then disconnects the miners, flushes the state and closes the pool connections. It returns the error of
+// ctx if shares were still pending. Only the first call shuts down the proxy, the next ones return immediately.
+func (p *Proxy) Shutdown(ctx context.Context) error {
+	var err error
+	p.shutdownOnce.Do(func() {
+		p.shuttingDown.Store(true)
+		close(p.done)
+		if !p.started.Load() {
+			return
+		}
+
+		p.stratumListener.Close()
+		p.getworkListener.Close()
+
+		err = p.waitPendingShares(ctx)
+		p.disconnectMiners()
+		p.flushState()
+
+		p.apiListener.Close()
+		p.closeSessions()
+		close(p.eventsDone)
+	})
+	return err
+}
+
+// waits for the given duration, and returns false if the proxy is shutting down
+func (p *Proxy) sleep(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-p.done:
+		return false
+	}
+}
+
+// waits until the pool answered the pending shares, or ctx is done
+func (p *Proxy) waitPendingShares(ctx context.Context) error {
+	ticker := time.NewTicker(SHUTDOWN_POLL_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		pending := p.shareTracker.GetPendingCount()
+		for _, s := range p.listSessions() {
+			pending += s.pendingShares()
+		}
+		if pending == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Warnf("%d shares are still pending, shutting down without their result", pending)
+			return ctx.Err()
+		case <-ticker.C:
+			log.Debugf("waiting for %d pending shares", pending)
+		}
+	}
+}
+
+// asks the stratum miners to reconnect, and closes the getwork connections with a going away close frame
+func (p *Proxy) disconnectMiners() {
+	p.stratumServer.RLock()
+	n := 0
+	for _, c := range p.stratumServer.Conns {
+		c.Lock()
+		if c.Alive {
+			if err := c.SendReconnect(); err != nil {
+				stratumLog.Debug("failed to send client.reconnect:", err)
+			}
+			c.Close()
+			n++
+		}
+		c.Unlock()
+	}
+	p.stratumServer.RUnlock()
+
+	p.socketsMut.RLock()
+	for _, c := range p.sockets {
+		if c != nil {
+			c.Lock()
+			c.CloseGoingAway("proxy shutting down")
+			c.Unlock()
+			n++
+		}
+	}
+	p.socketsMut.RUnlock()
+
+	log.Info("Disconnected", n, "miners")
+}
+
+// saves the learned workers, closes the share journal and delivers the pending webhook notifications
+func (p *Proxy) flushState() {
+	total := p.totalStats.Snapshot()
+	log.Infof("Uptime %s | hashrate 24h %s | shares: %d accepted, %d rejected, %d stale",
+		time.Since(p.startTime).Round(time.Second), util.FormatHashrate(p.totalHashrate.Hashrate(24*time.Hour)),
+		total.Accepted, total.Rejected, total.Stale)
+
+	if p.getCfg().LearnWorkers {
+		p.mutWorkers.Lock()
+		p.saveWorkers()
+		p.mutWorkers.Unlock()
+	}
+
+	p.closeJournal()
+
+	if n := p.notifier.Load(); n != nil {
+		done := make(chan struct{})
+		go func() {
+			n.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			log.Warn("shutting down without waiting for the pending webhook notifications")
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package proxy
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+	"xelis-mining-proxy/log"
+	"xelis-mining-proxy/util"
+)
+
+// Wallet split: a percentage of the work of the miners mining to the configured wallet is mined to other wallets,
+// each with its own pool session. The miners are placed, and moved one at a time, so that the accepted work of
+// each wallet follows its percentage.
+
+// interval between two moves of a miner, also the time over which the hashrate deficit of a wallet is counted as work
+const SPLIT_REBALANCE_INTERVAL = time.Minute
+
+type splitTarget struct {
+	session *Session
+	percent float64
+}
+
+// returns the sessions of the split with their percentage, the default session first. It returns nil when the
+// split is disabled.
+func (p *Proxy) getSplitTargets() []splitTarget {
+	cfg := p.getCfg()
+
+	p.mutSplit.Lock()
+	defer p.mutSplit.Unlock()
+
+	if len(p.splitSessions) == 0 {
+		return nil
+	}
+
+	wallets := make([]string, 0, len(p.splitSessions))
+	for wallet := range p.splitSessions {
+		wallets = append(wallets, wallet)
+	}
+	slices.Sort(wallets)
+
+	targets := []splitTarget{{session: p.defaultSession, percent: 100}}
+	for _, wallet := range wallets {
+		percent := cfg.WalletSplit[wallet]
+		targets = append(targets, splitTarget{p.splitSessions[wallet], percent})
+		targets[0].percent -= percent
+	}
+	return targets
+}
+
+// opens the sessions of the wallets added to the split, which are kept open while they are in the split, releases
+// the removed ones, and restarts the measure of the work
+func (p *Proxy) configureWalletSplit() {
+	split := p.getCfg().WalletSplit
+
+	p.mutSplit.Lock()
+	defer p.mutSplit.Unlock()
+
+	for wallet, s := range p.splitSessions {
+		if _, ok := split[wallet]; !ok {
+			delete(p.splitSessions, wallet)
+			s.release()
+		}
+	}
+	for wallet := range split {
+		if _, ok := p.splitSessions[wallet]; !ok {
+			p.splitSessions[wallet] = p.acquireSession(wallet)
+		}
+	}
+
+	clear(p.splitBase)
+	p.splitBase[p.defaultSession] = p.defaultSession.getWork()
+	for _, s := range p.splitSessions {
+		p.splitBase[s] = s.getWork()
+	}
+
+	if len(split) > 0 {
+		log.Info("Splitting the work between", len(split)+1, "wallets")
+	}
+}
+
+// returns the work accepted by the session since the split was configured
+func (p *Proxy) splitWork(s *Session) float64 {
+	p.mutSplit.Lock()
+	defer p.mutSplit.Unlock()
+
+	return s.getWork() - p.splitBase[s]
+}
+
+// a miner placed by the wallet split
+type splitMiner struct {
+	name    string
+	rate    float64
+	session *Session
+	move    func(to *Session)
+}
+
+// returns the miners placed by the wallet split. The miners without hashrate yet count with the average hashrate.
+func (p *Proxy) listSplitMiners() []splitMiner {
+	miners := []splitMiner{}
+
+	p.stratumServer.RLock()
+	for _, c := range p.stratumServer.Conns {
+		c.RLock()
+		if c.Alive && c.split {
+			miners = append(miners, splitMiner{
+				name:    workerName(c.Worker, c.IP),
+				rate:    c.Hashrate.Hashrate(MAIN_HASHRATE_WINDOW),
+				session: c.session,
+				move:    c.moveSession,
+			})
+		}
+		c.RUnlock()
+	}
+	p.stratumServer.RUnlock()
+
+	p.socketsMut.RLock()
+	for _, c := range p.sockets {
+		if c == nil {
+			continue
+		}
+		c.RLock()
+		if c.split {
+			miners = append(miners, splitMiner{
+				name:    workerName(c.Worker, util.RemovePort(c.IP())),
+				rate:    c.Hashrate.Hashrate(MAIN_HASHRATE_WINDOW),
+				session: c.session,
+				move:    c.moveSession,
+			})
+		}
+		c.RUnlock()
+	}
+	p.socketsMut.RUnlock()
+
+	total, n := 0.0, 0
+	for _, m := range miners {
+		if m.rate > 0 {
+			total += m.rate
+			n++
+		}
+	}
+	average := 1.0
+	if n > 0 {
+		average = total / float64(n)
+	}
+	for i := range miners {
+		if miners[i].rate == 0 {
+			miners[i].rate = average
+		}
+	}
+	return miners
+}
+
+// returns the work each target is missing to follow its percentage: the accepted work, plus the work the
+// hashrate of its miners is missing during SPLIT_REBALANCE_INTERVAL
+func (p *Proxy) splitDeficits(targets []splitTarget, miners []splitMiner) []float64 {
+	percents := make([]float64, len(targets))
+	work := make([]float64, len(targets))
+	rates := make([]float64, len(targets))
+	for i, t := range targets {
+		percents[i] = t.percent
+		work[i] = p.splitWork(t.session)
+		for _, m := range miners {
+			if m.session == t.session {
+				rates[i] += m.rate
+			}
+		}
+	}
+
+	deficits := util.SplitDeficits(percents, work)
+	for i, d := range util.SplitDeficits(percents, rates) {
+		deficits[i] += d * SPLIT_REBALANCE_INTERVAL.Seconds()
+	}
+	return deficits
+}
+
+// returns the session of a miner mining to the configured wallet: the preferred session if it is in the split,
+// otherwise the session with the largest deficit
+func (p *Proxy) splitSession(preferred *Session) *Session {
+	targets := p.getSplitTargets()
+	if targets == nil {
+		return p.defaultSession
+	}
+	for _, t := range targets {
+		if t.session == preferred {
+			return preferred
+		}
+	}
+
+	deficits := p.splitDeficits(targets, p.listSplitMiners())
+	best := 0
+	for i, d := range deficits {
+		if d > deficits[best] {
+			best = i
+		}
+	}
+	return targets[best].session
+}
+
+// periodically moves a miner from the session with the largest surplus of work to the one with the largest
+// deficit, when it brings both closer to their percentage
+func (p *Proxy) splitRebalancer() {
+	for p.sleep(SPLIT_REBALANCE_INTERVAL) {
+		targets := p.getSplitTargets()
+		if targets == nil {
+			continue
+		}
+
+		miners := p.listSplitMiners()
+		deficits := p.splitDeficits(targets, miners)
+		from, to := 0, 0
+		for i, d := range deficits {
+			if d < deficits[from] {
+				from = i
+			}
+			if d > deficits[to] {
+				to = i
+			}
+		}
+
+		// the miner whose work brings the deficits the closest to zero
+		var best *splitMiner
+		bestError := math.Inf(1)
+		for i, m := range miners {
+			if m.session != targets[from].session {
+				continue
+			}
+			amount := m.rate * SPLIT_REBALANCE_INTERVAL.Seconds()
+			if !util.SplitMoveImproves(deficits[from], deficits[to], amount) {
+				continue
+			}
+			if e := math.Abs(deficits[from]+amount) + math.Abs(deficits[to]-amount); e < bestError {
+				best, bestError = &miners[i], e
+			}
+		}
+		if best == nil {
+			continue
+		}
+
+		target := targets[to].session
+		log.Infof("Moving miner %s to wallet %s for the wallet split", best.name, target.wallet(p.getCfg()))
+		best.move(target)
+	}
+}
+
+// SplitInfo compares the work of a wallet of the split with its percentage
+type SplitInfo struct {
+	Wallet  string  `json:"wallet"`
+	Target  float64 `json:"target"`
+	Actual  float64 `json:"actual"`
+	Work    float64 `json:"work"`
+	Miners  int     `json:"miners"`
+	Default bool    `json:"default"`
+}
+
+// returns the target and actual percentage of the work of each wallet of the split
+func (p *Proxy) getSplitInfo() []SplitInfo {
+	targets := p.getSplitTargets()
+	miners := p.listSplitMiners()
+	cfg := p.getCfg()
+
+	list := []SplitInfo{}
+	total := 0.0
+	for _, t := range targets {
+		info := SplitInfo{
+			Wallet:  t.session.wallet(cfg),
+			Target:  t.percent,
+			Work:    p.splitWork(t.session),
+			Default: t.session.isDefault(),
+		}
+		for _, m := range miners {
+			if m.session == t.session {
+				info.Miners++
+			}
+		}
+		total += info.Work
+		list = append(list, info)
+	}
+	for i := range list {
+		if total > 0 {
+			list[i].Actual = list[i].Work / total * 100
+		}
+	}
+	return list
+}
+
+// logs the target and actual percentage of the work of each wallet of the split
+func (p *Proxy) logSplit() {
+	info := p.getSplitInfo()
+	if len(info) == 0 {
+		return
+	}
+
+	parts := make([]string, len(info))
+	for i, s := range info {
+		parts[i] = fmt.Sprintf("%s %.1f%% (target %.1f%%, %d miners)", s.Wallet, s.Actual, s.Target, s.Miners)
+	}
+	log.Info("Wallet split:", strings.Join(parts, " | "))
+}
@@ -0,0 +1,230 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+	"xelis-mining-proxy/log"
+	"xelis-mining-proxy/util"
+)
+
+// ShareCounters holds the share statistics of a miner, or of the whole proxy.
+// A round lasts for one block height.
+type ShareCounters struct {
+	Accepted  uint64
+	Rejected  uint64
+	Stale     uint64
+	Work      float64 // sum of the assigned difficulty of the accepted shares
+	LastShare time.Time
+
+	RoundHeight    uint64
+	RoundWork      float64 // work of the accepted shares in the current round
+	BestShare      uint64  // best achieved difficulty in the current round
+	PrevBestShare  uint64  // best achieved difficulty in the previous round
+	PrevRoundWork  float64
+	PrevRoundDiff  uint64
+	PrevRoundEnded time.Time
+}
+
+// ShareStats is a ShareCounters that is safe for concurrent use
+type ShareStats struct {
+	ShareCounters
+
+	mu sync.Mutex
+}
+
+// AddAccepted records an accepted share. achieved is the difficulty reached by the share, and must be at
+// least the assigned difficulty.
+func (s *ShareStats) AddAccepted(assigned, achieved uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Accepted++
+	s.Work += float64(assigned)
+	s.RoundWork += float64(assigned)
+	s.LastShare = time.Now()
+
+	if achieved > s.BestShare {
+		s.BestShare = achieved
+	}
+}
+
+func (s *ShareStats) AddRejected() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Rejected++
+}
+
+func (s *ShareStats) AddStale() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Stale++
+}
+
+// NewRound ends the current round, which was mined with the given upstream difficulty
+func (s *ShareStats) NewRound(height, diff uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.PrevBestShare = s.BestShare
+	s.PrevRoundWork = s.RoundWork
+	s.PrevRoundDiff = diff
+	s.PrevRoundEnded = time.Now()
+
+	s.RoundHeight = height
+	s.RoundWork = 0
+	s.BestShare = 0
+}
+
+// Effort returns the work of the current round relative to the upstream difficulty, in percent
+func (s *ShareStats) Effort(diff uint64) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if diff == 0 {
+		return 0
+	}
+	return s.RoundWork / float64(diff) * 100
+}
+
+// Snapshot returns a copy of the statistics that is safe to read
+func (s *ShareStats) Snapshot() ShareCounters {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.ShareCounters
+}
+
+func (p *Proxy) addRejectReason(reason string) {
+	p.mutRejectReasons.Lock()
+	defer p.mutRejectReasons.Unlock()
+
+	p.rejectReasons[reason]++
+}
+
+func (p *Proxy) getRejectReasons() map[string]uint64 {
+	p.mutRejectReasons.Lock()
+	defer p.mutRejectReasons.Unlock()
+
+	reasons := make(map[string]uint64, len(p.rejectReasons))
+	for k, v := range p.rejectReasons {
+		reasons[k] = v
+	}
+	return reasons
+}
+
+// ends the round of the proxy and of every connected miner, logging their best share and effort
+func (p *Proxy) newStatsRound(prev Job, height uint64) {
+	if prev.Height == 0 || prev.Height == height {
+		return
+	}
+
+	total := p.totalStats.Snapshot()
+	log.Infof("round %d ended: %d accepted shares, work %.0f, best share %d, effort %.2f%%", prev.Height,
+		total.Accepted, total.RoundWork, total.BestShare, p.totalStats.Effort(prev.Diff))
+	p.totalStats.NewRound(height, prev.Diff)
+
+	p.stratumServer.RLock()
+	for _, c := range p.stratumServer.Conns {
+		st := c.Stats.Snapshot()
+		log.Debugf("round %d: Stratum miner %s work %.0f, best share %d, effort %.2f%%", prev.Height, c.IP,
+			st.RoundWork, st.BestShare, c.Stats.Effort(prev.Diff))
+		c.Stats.NewRound(height, prev.Diff)
+	}
+	p.stratumServer.RUnlock()
+
+	p.socketsMut.RLock()
+	for _, c := range p.sockets {
+		if c == nil {
+			continue
+		}
+		st := c.Stats.Snapshot()
+		log.Debugf("round %d: Getwork miner %s work %.0f, best share %d, effort %.2f%%", prev.Height, c.IP(),
+			st.RoundWork, st.BestShare, c.Stats.Effort(prev.Diff))
+		c.Stats.NewRound(height, prev.Diff)
+	}
+	p.socketsMut.RUnlock()
+}
+
+// MinerInfo describes a connected downstream miner
+type MinerInfo struct {
+	ID          uint64             `json:"id"`
+	Protocol    string             `json:"protocol"`
+	IP          string             `json:"ip"`
+	Agent       string             `json:"agent"`
+	Wallet      string             `json:"wallet"`
+	Worker      string             `json:"worker"`
+	ConnectedAt time.Time          `json:"connected_at"`
+	Hashrate    float64            `json:"hashrate"`
+	Hashrates   map[string]float64 `json:"hashrates"`
+	Accepted    uint64             `json:"accepted"`
+	Rejected    uint64             `json:"rejected"`
+	Stale       uint64             `json:"stale"`
+	Work        float64            `json:"work"`
+	BestShare   uint64             `json:"best_share"`
+	Effort      float64            `json:"effort"`
+	LastShare   time.Time          `json:"last_share"`
+}
+
+func newMinerInfo(st ShareCounters, diff uint64) MinerInfo {
+	info := MinerInfo{
+		Accepted:  st.Accepted,
+		Rejected:  st.Rejected,
+		Stale:     st.Stale,
+		Work:      st.Work,
+		BestShare: st.BestShare,
+		LastShare: st.LastShare,
+	}
+	if diff != 0 {
+		info.Effort = st.RoundWork / float64(diff) * 100
+	}
+	return info
+}
+
+// Miners returns the information of all the connected miners
+func (p *Proxy) Miners() []MinerInfo {
+	diff := p.defaultSession.getJob().Diff
+
+	miners := make([]MinerInfo, 0)
+
+	p.stratumServer.RLock()
+	for _, c := range p.stratumServer.Conns {
+		c.RLock()
+		if c.Alive {
+			info := newMinerInfo(c.Stats.Snapshot(), diff)
+			info.ID = c.ID
+			info.Protocol = "stratum"
+			info.IP = c.IP
+			info.Agent = c.Agent
+			info.Wallet = c.Wallet
+			info.Worker = c.Worker
+			info.ConnectedAt = c.ConnectedAt
+			info.Hashrate = c.Hashrate.Hashrate(MAIN_HASHRATE_WINDOW)
+			info.Hashrates = c.Hashrate.Hashrates()
+			miners = append(miners, info)
+		}
+		c.RUnlock()
+	}
+	p.stratumServer.RUnlock()
+
+	p.socketsMut.RLock()
+	for _, c := range p.sockets {
+		if c == nil {
+			continue
+		}
+		info := newMinerInfo(c.Stats.Snapshot(), diff)
+		info.ID = c.ID
+		info.Protocol = "getwork"
+		info.IP = util.RemovePort(c.IP())
+		info.Wallet = c.Wallet
+		info.Worker = c.Worker
+		info.ConnectedAt = c.ConnectedAt
+		info.Hashrate = c.Hashrate.Hashrate(MAIN_HASHRATE_WINDOW)
+		info.Hashrates = c.Hashrate.Hashrates()
+		miners = append(miners, info)
+	}
+	p.socketsMut.RUnlock()
+
+	return miners
+}
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+)
+
+// number of upstream jobs kept in the job history
+const JOBS_HISTORY = 20
+
+// UpstreamState describes the connection to the pool
+type UpstreamState struct {
+	Url            string
+	Protocol       string
+	Connected      bool
+	ConnectedSince time.Time
+	LastJob        time.Time
+	Reconnects     uint64
+
+	proxy *Proxy
+
+	sync.RWMutex
+}
+
+func (u *UpstreamState) setConnecting(url string) {
+	u.Lock()
+	defer u.Unlock()
+
+	if u.Url != "" && u.Url != url {
+		u.proxy.notifyPoolSwitched(u.Url, url)
+	}
+	u.Url = url
+	u.Protocol = u.proxy.getCfg().PoolProtocol
+
+	u.proxy.getPoolHealth(url).connecting()
+}
+
+func (u *UpstreamState) setConnected() {
+	u.Lock()
+	defer u.Unlock()
+
+	if !u.ConnectedSince.IsZero() {
+		u.Reconnects++
+	}
+	u.Connected = true
+	u.ConnectedSince = time.Now()
+
+	u.proxy.getPoolHealth(u.Url).connected()
+	u.proxy.notifyUpstreamConnected(u.Url)
+}
+
+func (u *UpstreamState) setDisconnected() {
+	u.Lock()
+	defer u.Unlock()
+
+	u.Connected = false
+
+	u.proxy.getPoolHealth(u.Url).disconnected()
+	u.proxy.notifyUpstreamDisconnected(u.Url)
+}
+
+// returns the health statistics of the current pool
+func (u *UpstreamState) health() *PoolHealth {
+	u.RLock()
+	defer u.RUnlock()
+
+	return u.proxy.getPoolHealth(u.Url)
+}
+
+func (u *UpstreamState) setLastJob(t time.Time) {
+	u.Lock()
+	defer u.Unlock()
+
+	u.LastJob = t
+}
+
+func (p *Proxy) addJobHistory(job Job) {
+	p.mutJobHistory.Lock()
+	defer p.mutJobHistory.Unlock()
+
+	p.jobHistory = append(p.jobHistory, job)
+	if len(p.jobHistory) > JOBS_HISTORY {
+		p.jobHistory = p.jobHistory[1:]
+	}
+}
@@ -0,0 +1,214 @@
+"use strict";
+
+// number of samples kept in the hashrate charts
+const HISTORY = 300;
+// a miner without shares for this long is highlighted
+const OLD_SHARE = 5 * 60 * 1000;
+const COLORS = ["#02ffcf", "#ffb302", "#ff5c5c", "#7c8cff", "#c45cff", "#5cff7c", "#ff8ac4", "#8ad8ff"];
+
+const totalHistory = [];
+const workerHistory = {};
+
+function $(id) {
+	return document.getElementById(id);
+}
+
+function formatHashrate(h) {
+	const units = ["H/s", "KH/s", "MH/s", "GH/s", "TH/s"];
+	let i = 0;
+	while (h >= 1000 && i < units.length - 1) {
+		h /= 1000;
+		i++;
+	}
+	return h.toFixed(2) + " " + units[i];
+}
+
+function formatAge(date) {
+	const t = new Date(date).getTime();
+	if (t <= 0) {
+		return "never";
+	}
+	const s = Math.max(0, Math.round((Date.now() - t) / 1000));
+	if (s < 60) {
+		return s + "s ago";
+	}
+	if (s < 3600) {
+		return Math.floor(s / 60) + "m ago";
+	}
+	return Math.floor(s / 3600) + "h ago";
+}
+
+function workerName(m) {
+	return m.worker || m.ip;
+}
+
+function cell(row, text, cls) {
+	const td = document.createElement("td");
+	td.textContent = text;
+	if (cls) {
+		td.className = cls;
+	}
+	row.appendChild(td);
+}
+
+function drawChart(canvas, series) {
+	const ctx = canvas.getContext("2d");
+	const w = canvas.width = canvas.clientWidth;
+	const h = canvas.height;
+	ctx.clearRect(0, 0, w, h);
+
+	let max = 0;
+	for (const s of series) {
+		for (const v of s.values) {
+			max = Math.max(max, v);
+		}
+	}
+	if (max === 0) {
+		max = 1;
+	}
+
+	ctx.fillStyle = "#8a8f98";
+	ctx.font = "11px sans-serif";
+	ctx.fillText(formatHashrate(max), 4, 12);
+
+	for (const s of series) {
+		ctx.strokeStyle = s.color;
+		ctx.lineWidth = 2;
+		ctx.beginPath();
+		s.values.forEach((v, i) => {
+			const x = w - (s.values.length - 1 - i) * (w / (HISTORY - 1));
+			const y = h - 2 - (v / max) * (h - 20);
+			if (i === 0) {
+				ctx.moveTo(x, y);
+			} else {
+				ctx.lineTo(x, y);
+			}
+		});
+		ctx.stroke();
+	}
+}
+
+function pushSample(arr, v) {
+	arr.push(v);
+	if (arr.length > HISTORY) {
+		arr.shift();
+	}
+}
+
+function update(data) {
+	const st = data.stats;
+
+	$("version").textContent = "v" + st.version;
+	$("pool-url").textContent = st.pool.url || "-";
+	$("pool-state").textContent = st.pool.connected ? "connected" : "disconnected";
+	$("pool-state").className = "badge " + (st.pool.connected ? "ok" : "bad");
+	$("pool-since").textContent = st.pool.connected ? "since " + new Date(st.pool.connected_since).toLocaleString() : "";
+	$("pool-pending").textContent = st.pool.pending_shares;
+
+	$("job-height").textContent = st.job.height;
+	$("job-algorithm").textContent = st.job.algorithm || "-";
+	$("job-difficulty").textContent = st.job.difficulty;
+
+	$("hashrate").textContent = formatHashrate(st.hashrate);
+	$("miners").textContent = st.miners;
+	$("effort").textContent = st.effort.toFixed(2);
+	$("missing").textContent = st.missing_workers.length ? "Missing: " + st.missing_workers.join(", ") : "";
+	$("accepted").textContent = st.accepted;
+	$("rejected").textContent = st.rejected;
+	$("stale").textContent = st.stale;
+	$("best-share").textContent = st.best_share;
+
+	// miner list
+	const list = $("miner-list");
+	list.replaceChildren();
+	for (const m of data.miners) {
+		const row = document.createElement("tr");
+		const old = Date.now() - new Date(m.last_share).getTime() > OLD_SHARE;
+		cell(row, m.id);
+		cell(row, workerName(m));
+		cell(row, m.ip);
+		cell(row, m.protocol);
+		cell(row, m.agent);
+		cell(row, formatHashrate(m.hashrate));
+		cell(row, m.accepted);
+		cell(row, m.rejected);
+		cell(row, m.stale);
+		cell(row, formatAge(m.last_share), old ? "old" : "");
+		list.appendChild(row);
+	}
+
+	// reject reasons
+	const reasons = $("reject-reasons");
+	reasons.replaceChildren();
+	for (const [reason, n] of Object.entries(st.reject_reasons || {}).sort((a, b) => b[1] - a[1])) {
+		const row = document.createElement("tr");
+		cell(row, reason);
+		cell(row, n);
+		reasons.appendChild(row);
+	}
+
+	// charts
+	pushSample(totalHistory, st.hashrate);
+
+	const workers = {};
+	for (const m of data.miners) {
+		const name = workerName(m);
+		workers[name] = (workers[name] || 0) + m.hashrate;
+	}
+	for (const name of new Set([...Object.keys(workerHistory), ...Object.keys(workers)])) {
+		if (!workerHistory[name]) {
+			workerHistory[name] = [];
+		}
+		pushSample(workerHistory[name], workers[name] || 0);
+	}
+
+	drawChart($("chart-total"), [{ color: COLORS[0], values: totalHistory }]);
+
+	const series = Object.keys(workerHistory).sort().map((name, i) => ({
+		name: name,
+		color: COLORS[i % COLORS.length],
+		values: workerHistory[name],
+	}));
+	drawChart($("chart-workers"), series);
+
+	const legend = $("chart-legend");
+	legend.replaceChildren();
+	for (const s of series) {
+		const span = document.createElement("span");
+		span.textContent = "● " + s.name;
+		span.style.color = s.color;
+		legend.appendChild(span);
+	}
+
+	// log tail
+	if (data.logs && data.logs.length > 0) {
+		const log = $("log");
+		const atBottom = log.scrollTop + log.clientHeight >= log.scrollHeight - 5;
+		log.textContent += data.logs.join("\n") + "\n";
+		const lines = log.textContent.split("\n");
+		if (lines.length > 500) {
+			log.textContent = lines.slice(lines.length - 500).join("\n");
+		}
+		if (atBottom) {
+			log.scrollTop = log.scrollHeight;
+		}
+	}
+}
+
+function connect() {
+	const proto = location.protocol === "https:" ? "wss:" : "ws:";
+	const ws = new WebSocket(proto + "//" + location.host + "/ws");
+
+	ws.onopen = () => {
+		$("live").textContent = "live";
+		$("live").className = "badge ok";
+	};
+	ws.onmessage = (ev) => update(JSON.parse(ev.data));
+	ws.onclose = () => {
+		$("live").textContent = "disconnected";
+		$("live").className = "badge bad";
+		setTimeout(connect, 2000);
+	};
+}
+
+connect();
@@ -0,0 +1,358 @@
+package proxy
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+	"xelis-mining-proxy/log"
+	"xelis-mining-proxy/util"
+)
+
+// Inventory of the workers: connected, expected in the config, or learned from previous connections
+
+const (
+	WORKER_ONLINE       = "online"
+	WORKER_SLOW         = "slow"         // share rate below its historical rate
+	WORKER_DISCONNECTED = "disconnected" // disconnected for less than miner_offline_delay
+	WORKER_OFFLINE      = "offline"      // missing for more than miner_offline_delay
+)
+
+// learned workers not seen for this long are forgotten
+const LEARNED_WORKER_EXPIRY = 7 * 24 * time.Hour
+
+// WorkerState is the state of a worker of the inventory
+type WorkerState struct {
+	Name     string
+	Expected bool // declared in expected_workers
+	Learned  bool // remembered from a previous connection
+
+	Connections    int
+	ConnectedSince time.Time
+	DisconnectedAt time.Time
+	FirstSeen      time.Time
+	LastShare      time.Time
+
+	Status          string
+	offlineNotified bool
+}
+
+// returns the last time the worker was connected
+func (w *WorkerState) lastSeen() time.Time {
+	if w.Connections > 0 {
+		return time.Now()
+	}
+	return w.DisconnectedAt
+}
+
+// WorkerInfo describes a worker of the inventory
+type WorkerInfo struct {
+	Name        string    `json:"name"`
+	Status      string    `json:"status"`
+	Expected    bool      `json:"expected"`
+	Learned     bool      `json:"learned"`
+	Connections int       `json:"connections"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	LastShare   time.Time `json:"last_share"`
+	Hashrate    float64   `json:"hashrate"`
+	Hashrate24h float64   `json:"hashrate_24h"`
+}
+
+// learned worker, as saved in workers.json
+type learnedWorker struct {
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	LastShare time.Time `json:"last_share"`
+}
+
+// interval at which the learned workers are saved when they didn't change, to keep their last seen time
+const WORKERS_SAVE_INTERVAL = 10 * time.Minute
+
+func (p *Proxy) getWorker(name string) *WorkerState {
+	w := p.workers[name]
+	if w == nil {
+		w = &WorkerState{
+			Name:   name,
+			Status: WORKER_DISCONNECTED,
+		}
+		p.workers[name] = w
+	}
+	return w
+}
+
+// loads the expected workers from the config and the learned workers from workers.json
+func (p *Proxy) loadWorkers() {
+	cfg := p.getCfg()
+
+	p.mutWorkers.Lock()
+	defer p.mutWorkers.Unlock()
+
+	for _, name := range cfg.ExpectedWorkers {
+		p.getWorker(name).Expected = true
+	}
+
+	if !cfg.LearnWorkers {
+		return
+	}
+
+	data, err := os.ReadFile(p.dataPath("workers.json"))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warn("failed to read learned workers:", err)
+		}
+		return
+	}
+
+	var learned map[string]learnedWorker
+	err = json.Unmarshal(data, &learned)
+	if err != nil {
+		log.Warn("failed to read learned workers:", err)
+		return
+	}
+
+	for name, v := range learned {
+		if time.Since(v.LastSeen) > LEARNED_WORKER_EXPIRY {
+			continue
+		}
+
+		w := p.getWorker(name)
+		w.Learned = true
+		w.FirstSeen = v.FirstSeen
+		w.DisconnectedAt = v.LastSeen
+		w.LastShare = v.LastShare
+	}
+	log.Info("Loaded", len(p.workers), "known workers")
+}
+
+// NOTE: mutWorkers MUST be locked before calling this
+func (p *Proxy) saveWorkers() {
+	learned := make(map[string]learnedWorker)
+	for name, w := range p.workers {
+		if w.Learned && time.Since(w.lastSeen()) < LEARNED_WORKER_EXPIRY {
+			learned[name] = learnedWorker{
+				FirstSeen: w.FirstSeen,
+				LastSeen:  w.lastSeen(),
+				LastShare: w.LastShare,
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(learned, "", "\t")
+	if err != nil {
+		log.Err(err)
+		return
+	}
+
+	err = os.MkdirAll(p.dataDir, 0o750)
+	if err == nil {
+		err = util.WriteFileAtomic(p.dataPath("workers.json"), data, 0o640)
+	}
+	if err != nil {
+		log.Warn("failed to save learned workers:", err)
+		return
+	}
+	p.workersDirty = false
+	p.workersSavedAt = time.Now()
+}
+
+// records a new connection of a worker
+func (p *Proxy) minerConnected(name string) {
+	p.mutWorkers.Lock()
+	defer p.mutWorkers.Unlock()
+
+	w := p.getWorker(name)
+	if w.Connections == 0 {
+		w.ConnectedSince = time.Now()
+	}
+	w.Connections++
+	if w.FirstSeen.IsZero() {
+		w.FirstSeen = time.Now()
+	}
+	if p.getCfg().LearnWorkers && !w.Learned {
+		w.Learned = true
+		p.workersDirty = true
+	}
+
+	p.updateWorkerStatus(w)
+}
+
+// records a closed connection of a worker
+func (p *Proxy) minerDisconnected(name string) {
+	p.mutWorkers.Lock()
+	defer p.mutWorkers.Unlock()
+
+	w := p.getWorker(name)
+	w.Connections--
+	if w.Connections > 0 {
+		return
+	}
+	w.Connections = 0
+	w.DisconnectedAt = time.Now()
+	if w.Learned {
+		p.workersDirty = true
+	}
+
+	p.updateWorkerStatus(w)
+}
+
+// records an accepted share of a worker
+func (p *Proxy) workerShare(name string) {
+	p.mutWorkers.Lock()
+	defer p.mutWorkers.Unlock()
+
+	p.getWorker(name).LastShare = time.Now()
+}
+
+// returns the 15 minutes and 24 hours hashrate of a worker
+func (p *Proxy) workerHashrate(name string) (float64, float64) {
+	p.mutHashrates.Lock()
+	defer p.mutHashrates.Unlock()
+
+	m := p.workerHashrates[name]
+	if m == nil {
+		return 0, 0
+	}
+	return m.Hashrate(MAIN_HASHRATE_WINDOW), m.Hashrate(24 * time.Hour)
+}
+
+// returns the status of the worker, computed from its connections and share rate
+//
+// NOTE: mutWorkers MUST be locked before calling this
+func (p *Proxy) workerStatus(w *WorkerState) string {
+	cfg := p.getCfg()
+
+	if w.Connections == 0 {
+		since := w.DisconnectedAt
+		if since.Before(p.startTime) {
+			// workers that didn't connect since the start have as much time as the others to reconnect
+			since = p.startTime
+		}
+		if time.Since(since) > time.Duration(cfg.MinerOfflineDelay)*time.Second {
+			return WORKER_OFFLINE
+		}
+		return WORKER_DISCONNECTED
+	}
+
+	// the historical rate needs some history, and the recent rate a full window of connection
+	if cfg.WorkerSlowRatio > 0 && time.Since(p.startTime) > time.Hour &&
+		time.Since(w.ConnectedSince) > MAIN_HASHRATE_WINDOW {
+		recent, historical := p.workerHashrate(w.Name)
+		if recent < historical*cfg.WorkerSlowRatio/100 {
+			return WORKER_SLOW
+		}
+	}
+	return WORKER_ONLINE
+}
+
+// updates the status of the worker, logging and notifying its changes
+//
+// NOTE: mutWorkers MUST be locked before calling this
+func (p *Proxy) updateWorkerStatus(w *WorkerState) {
+	status := p.workerStatus(w)
+	if status == w.Status {
+		return
+	}
+	prev := w.Status
+	w.Status = status
+
+	switch status {
+	case WORKER_OFFLINE:
+		if w.DisconnectedAt.IsZero() {
+			log.Warnf("Worker %s is missing, it didn't connect since the start", w.Name)
+		} else {
+			log.Warnf("Worker %s is missing, last seen %s ago", w.Name,
+				time.Since(w.DisconnectedAt).Round(time.Second))
+		}
+		w.offlineNotified = p.notifyMinerOffline(w)
+	case WORKER_SLOW:
+		recent, historical := p.workerHashrate(w.Name)
+		log.Warnf("Worker %s share rate dropped to %.0f%% of its 24h rate", w.Name, recent/historical*100)
+	case WORKER_ONLINE:
+		if prev == WORKER_SLOW {
+			log.Infof("Worker %s share rate is back to normal", w.Name)
+		}
+	}
+
+	if prev == WORKER_OFFLINE && w.Connections > 0 {
+		log.Infof("Worker %s is back after %s", w.Name, time.Since(w.DisconnectedAt).Round(time.Second))
+		if w.offlineNotified {
+			w.offlineNotified = false
+			p.notifyMinerOnline(w)
+		}
+	}
+}
+
+// periodically updates the status of the workers and saves the learned workers
+func (p *Proxy) workerMonitor() {
+	for p.sleep(10 * time.Second) {
+		p.mutWorkers.Lock()
+		for name, w := range p.workers {
+			if !w.Expected && time.Since(w.lastSeen()) > LEARNED_WORKER_EXPIRY {
+				delete(p.workers, name)
+				p.workersDirty = p.workersDirty || w.Learned
+				continue
+			}
+			p.updateWorkerStatus(w)
+		}
+		if p.getCfg().LearnWorkers && (p.workersDirty || time.Since(p.workersSavedAt) > WORKERS_SAVE_INTERVAL) {
+			p.saveWorkers()
+		}
+		p.mutWorkers.Unlock()
+	}
+}
+
+// returns the inventory of the workers, sorted by name
+func (p *Proxy) listWorkers() []WorkerInfo {
+	p.mutWorkers.Lock()
+	defer p.mutWorkers.Unlock()
+
+	list := make([]WorkerInfo, 0, len(p.workers))
+	for _, w := range p.workers {
+		recent, historical := p.workerHashrate(w.Name)
+		list = append(list, WorkerInfo{
+			Name:        w.Name,
+			Status:      w.Status,
+			Expected:    w.Expected,
+			Learned:     w.Learned,
+			Connections: w.Connections,
+			FirstSeen:   w.FirstSeen,
+			LastSeen:    w.lastSeen(),
+			LastShare:   w.LastShare,
+			Hashrate:    recent,
+			Hashrate24h: historical,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// returns the names of the offline workers
+func (p *Proxy) missingWorkers() []string {
+	p.mutWorkers.Lock()
+	defer p.mutWorkers.Unlock()
+
+	list := []string{}
+	for _, w := range p.workers {
+		if w.Status == WORKER_OFFLINE {
+			list = append(list, w.Name)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+// replaces the expected workers
+func (p *Proxy) setExpectedWorkers(names []string) {
+	p.mutWorkers.Lock()
+	defer p.mutWorkers.Unlock()
+
+	for _, w := range p.workers {
+		w.Expected = false
+	}
+	for _, name := range names {
+		p.getWorker(name).Expected = true
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"xelis-mining-proxy/log"
+	"xelis-mining-proxy/proxy"
+)
+
+// Shutdown of the process on SIGINT, SIGTERM or ctrl+c in the console: the proxy is shut down gracefully, then the
+// process exits
+
+// true once the shutdown started: the configuration isn't reloaded
+var shuttingDown atomic.Bool
+
+var shutdownOnce sync.Once
+
+// shuts down on SIGINT or SIGTERM. A signal received during the shutdown exits immediately.
+func handleShutdownSignals(p *proxy.Proxy) {
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, syscall.SIGTERM, os.Interrupt)
+
+	go func() {
+		for range sig {
+			if shuttingDown.Load() {
+				log.Warn("Received a second signal, exiting without waiting for the pending shares")
+				log.Close()
+				os.Exit(1)
+			}
+			go shutdown(p)
+		}
+	}()
+}
+
+// shuts down the proxy, waiting shutdown_timeout seconds for the pending shares, and exits. It is safe to call it
+// more than once.
+func shutdown(p *proxy.Proxy) {
+	shutdownOnce.Do(func() {
+		shuttingDown.Store(true)
+
+		// the logs of the shutdown are shown on the terminal
+		if console != nil {
+			console.close()
+		}
+		log.Info("Shutting down, press ctrl+c again to exit immediately")
+
+		timeout := time.Duration(p.Config().ShutdownTimeout) * time.Second
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		p.Shutdown(ctx)
+
+		log.Info("Shutdown complete")
+		log.Close()
+		os.Exit(0)
+	})
+}
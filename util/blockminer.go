@@ -2,13 +2,11 @@ package util
 
 import (
 	"bytes"
-	"crypto/rand"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"time"
-	"xelis-mining-proxy/log"
 
 	"github.com/duggavo/serializer"
 )
@@ -85,27 +83,6 @@ func (b *BlockMiner) SetPublickey(p [32]byte) {
 	}
 }
 
-// Randomly generates the last 4 bytes of extra nonce
-func (b *BlockMiner) GenerateExtraNonce() {
-
-	rnd := make([]byte, 4)
-	_, err := rand.Read(rnd)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	nonceExtra := b.GetExtraNonce()
-
-	nonceExtra[28] = rnd[0]
-	nonceExtra[29] = rnd[1]
-	nonceExtra[30] = rnd[2]
-	nonceExtra[31] = rnd[3]
-
-	log.Debugf("nonce extra %x => %x", b.GetExtraNonce(), nonceExtra)
-	b.SetExtraNonce(nonceExtra)
-
-}
-
 // returns true if all 32 bytes of the extra nonces match
 func ValidateExtraNonces(a, b [32]byte) bool {
 	return bytes.Equal(a[:], b[:])
@@ -2,6 +2,7 @@ package util
 
 import (
 	"bytes"
+	"math"
 	"math/big"
 )
 
@@ -42,3 +43,17 @@ func CheckDiff(hash [32]byte, diff uint64) bool {
 
 	return bytes.Compare(hash[:], target[:]) < 0
 }
+
+// returns the difficulty reached by a hash, which is the inverse of GetTarget
+func HashToDifficulty(hash [32]byte) uint64 {
+	hashBigInt := big.NewInt(0).SetBytes(hash[:])
+	if hashBigInt.Sign() == 0 {
+		return math.MaxUint64
+	}
+
+	diff := hashBigInt.Div(maxBigInt, hashBigInt)
+	if !diff.IsUint64() {
+		return math.MaxUint64
+	}
+	return diff.Uint64()
+}
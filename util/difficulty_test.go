@@ -0,0 +1,27 @@
+package util
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHashToDifficulty(t *testing.T) {
+	for _, diff := range []uint64{1, 2, 1000, 123456789, 1 << 40} {
+		target := GetTargetBytes(diff)
+
+		got := HashToDifficulty(target)
+		if got != diff {
+			t.Errorf("HashToDifficulty(GetTargetBytes(%d)) = %d", diff, got)
+		}
+		if !CheckDiff([32]byte{}, diff) {
+			t.Errorf("zero hash should match difficulty %d", diff)
+		}
+	}
+
+	if got := HashToDifficulty([32]byte{}); got != math.MaxUint64 {
+		t.Errorf("HashToDifficulty(zero) = %d; want max", got)
+	}
+	if got := HashToDifficulty([32]byte{0: 0x80}); got != 1 {
+		t.Errorf("HashToDifficulty(0x80...) = %d; want 1", got)
+	}
+}
@@ -0,0 +1,96 @@
+package util
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// ExtraNonceAllocator hands out unique extra nonce suffixes (the last 4 bytes of the extra nonce) to the
+// downstream miners, so that no two miners ever work on the same nonce space.
+// Released suffixes are kept reserved for the same key during the reuse timeout, so a miner that
+// reconnects quickly gets its previous suffix back.
+type ExtraNonceAllocator struct {
+	mu        sync.Mutex
+	next      uint32
+	free      []uint32
+	lingering map[string]lingeringSuffix
+	timeout   time.Duration
+}
+
+type lingeringSuffix struct {
+	Suffix  uint32
+	Expires time.Time
+}
+
+func NewExtraNonceAllocator(timeout time.Duration) *ExtraNonceAllocator {
+	return &ExtraNonceAllocator{
+		lingering: make(map[string]lingeringSuffix),
+		timeout:   timeout,
+	}
+}
+
+// Allocate returns a suffix that is not used by any other miner. key identifies the miner across
+// reconnections (for example, IP and agent).
+func (a *ExtraNonceAllocator) Allocate(key string) uint32 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.expire(time.Now())
+
+	if l, ok := a.lingering[key]; ok {
+		delete(a.lingering, key)
+		return l.Suffix
+	}
+
+	if len(a.free) > 0 {
+		suffix := a.free[0]
+		a.free = a.free[1:]
+		return suffix
+	}
+
+	suffix := a.next
+	a.next++
+	return suffix
+}
+
+// Release gives back a suffix when its miner disconnects. The suffix stays reserved for the same key until
+// the reuse timeout expires.
+func (a *ExtraNonceAllocator) Release(key string, suffix uint32) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if old, ok := a.lingering[key]; ok {
+		// another connection with the same key is already waiting to be reused
+		a.free = append(a.free, old.Suffix)
+	}
+
+	a.lingering[key] = lingeringSuffix{
+		Suffix:  suffix,
+		Expires: time.Now().Add(a.timeout),
+	}
+}
+
+// InUse returns the number of suffixes currently assigned or reserved
+func (a *ExtraNonceAllocator) InUse() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return int(a.next) - len(a.free)
+}
+
+// allocator MUST be locked before calling this
+func (a *ExtraNonceAllocator) expire(now time.Time) {
+	for k, v := range a.lingering {
+		if now.After(v.Expires) {
+			delete(a.lingering, k)
+			a.free = append(a.free, v.Suffix)
+		}
+	}
+}
+
+// ApplyExtraNonceSuffix returns the extra nonce with its last 4 bytes replaced by suffix
+func ApplyExtraNonceSuffix(extraNonce [32]byte, suffix uint32) [32]byte {
+	binary.BigEndian.PutUint32(extraNonce[28:], suffix)
+	return extraNonce
+}
@@ -0,0 +1,43 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExtraNonceAllocator(t *testing.T) {
+	a := NewExtraNonceAllocator(50 * time.Millisecond)
+
+	seen := make(map[uint32]bool)
+	for i := 0; i < 1000; i++ {
+		s := a.Allocate("miner")
+		if seen[s] {
+			t.Fatalf("suffix %d allocated twice", s)
+		}
+		seen[s] = true
+	}
+
+	// a reconnecting miner gets its suffix back
+	a.Release("rig1", 5)
+	if s := a.Allocate("other"); s == 5 {
+		t.Fatal("lingering suffix given to another miner")
+	}
+	if s := a.Allocate("rig1"); s != 5 {
+		t.Fatalf("expected suffix 5 on reconnect, got %d", s)
+	}
+
+	// after the timeout, the suffix is recycled
+	a.Release("rig1", 5)
+	time.Sleep(60 * time.Millisecond)
+	if s := a.Allocate("other"); s != 5 {
+		t.Fatalf("expected recycled suffix 5, got %d", s)
+	}
+}
+
+func TestApplyExtraNonceSuffix(t *testing.T) {
+	xn := ApplyExtraNonceSuffix([32]byte{0x11, 31: 0xff}, 0x01020304)
+
+	if xn[0] != 0x11 || xn[28] != 1 || xn[29] != 2 || xn[30] != 3 || xn[31] != 4 {
+		t.Fatalf("unexpected extra nonce %x", xn)
+	}
+}
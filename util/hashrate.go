@@ -0,0 +1,171 @@
+package util
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// windows over which hashrates are estimated
+var HashrateWindows = []time.Duration{time.Minute, 15 * time.Minute, time.Hour, 24 * time.Hour}
+
+// HashrateMeter estimates a hashrate from the work (difficulty) of accepted shares.
+// Work is accumulated in 10 second buckets over the last hour, and 5 minute buckets over the last 24 hours.
+type HashrateMeter struct {
+	fine   bucketRing
+	coarse bucketRing
+	start  time.Time
+	last   time.Time
+
+	mu sync.Mutex
+}
+
+type bucketRing struct {
+	width   time.Duration
+	buckets []float64
+	last    int64 // number of the last bucket written (time / width)
+}
+
+func NewHashrateMeter() *HashrateMeter {
+	return NewHashrateMeterAt(time.Now())
+}
+
+// NewHashrateMeterAt returns a HashrateMeter that started measuring at the given time
+func NewHashrateMeterAt(start time.Time) *HashrateMeter {
+	return &HashrateMeter{
+		fine:   newBucketRing(10*time.Second, time.Hour),
+		coarse: newBucketRing(5*time.Minute, 24*time.Hour),
+		start:  start,
+	}
+}
+
+func newBucketRing(width, span time.Duration) bucketRing {
+	return bucketRing{
+		width:   width,
+		buckets: make([]float64, span/width),
+	}
+}
+
+// advances the ring to the bucket of t, clearing the buckets in between
+func (r *bucketRing) advance(t time.Time) int64 {
+	n := t.UnixNano() / int64(r.width)
+
+	if n > r.last {
+		for i := r.last + 1; i <= n && i <= r.last+int64(len(r.buckets)); i++ {
+			r.buckets[i%int64(len(r.buckets))] = 0
+		}
+		r.last = n
+	}
+	return n
+}
+
+func (r *bucketRing) add(t time.Time, work float64) {
+	n := r.advance(t)
+	if n <= r.last-int64(len(r.buckets)) {
+		return
+	}
+	r.buckets[n%int64(len(r.buckets))] += work
+}
+
+// returns the work in the buckets covering the window ending at t
+func (r *bucketRing) sum(t time.Time, window time.Duration) float64 {
+	n := r.advance(t)
+
+	count := int64(window / r.width)
+	if count > int64(len(r.buckets)) {
+		count = int64(len(r.buckets))
+	}
+
+	var sum float64
+	for i := n - count + 1; i <= n; i++ {
+		sum += r.buckets[((i%int64(len(r.buckets)))+int64(len(r.buckets)))%int64(len(r.buckets))]
+	}
+	return sum
+}
+
+// Add records the work of an accepted share
+func (m *HashrateMeter) Add(work float64) {
+	m.AddAt(time.Now(), work)
+}
+
+func (m *HashrateMeter) AddAt(t time.Time, work float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.fine.add(t, work)
+	m.coarse.add(t, work)
+	m.last = t
+}
+
+// Hashrate returns the estimated hashrate over the given window, in hashes per second
+func (m *HashrateMeter) Hashrate(window time.Duration) float64 {
+	return m.HashrateAt(time.Now(), window)
+}
+
+func (m *HashrateMeter) HashrateAt(t time.Time, window time.Duration) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var work float64
+	var width time.Duration
+	if window <= time.Hour {
+		work = m.fine.sum(t, window)
+		width = m.fine.width
+	} else {
+		work = m.coarse.sum(t, window)
+		width = m.coarse.width
+	}
+
+	// the current bucket is only partially elapsed
+	elapsed := window - width + time.Duration(t.UnixNano()%int64(width))
+	if since := t.Sub(m.start); since < elapsed {
+		elapsed = since
+	}
+	if elapsed < time.Second {
+		elapsed = time.Second
+	}
+
+	return work / elapsed.Seconds()
+}
+
+// Hashrates returns the estimated hashrate over all the HashrateWindows
+func (m *HashrateMeter) Hashrates() map[string]float64 {
+	now := time.Now()
+
+	rates := make(map[string]float64, len(HashrateWindows))
+	for _, w := range HashrateWindows {
+		rates[FormatWindow(w)] = m.HashrateAt(now, w)
+	}
+	return rates
+}
+
+// LastShare returns the time of the last recorded share
+func (m *HashrateMeter) LastShare() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.last
+}
+
+// formats a window duration as 1m, 15m, 1h, 24h...
+func FormatWindow(w time.Duration) string {
+	if w >= time.Hour && w%time.Hour == 0 {
+		return strconv.FormatInt(int64(w/time.Hour), 10) + "h"
+	}
+	if w >= time.Minute && w%time.Minute == 0 {
+		return strconv.FormatInt(int64(w/time.Minute), 10) + "m"
+	}
+	return strconv.FormatInt(int64(w/time.Second), 10) + "s"
+}
+
+// FormatHashrate formats a hashrate with its unit (H/s, KH/s, MH/s...)
+func FormatHashrate(h float64) string {
+	units := []string{"H/s", "KH/s", "MH/s", "GH/s", "TH/s", "PH/s"}
+
+	i := 0
+	for h >= 1000 && i < len(units)-1 {
+		h /= 1000
+		i++
+	}
+	return strconv.FormatFloat(h, 'f', 2, 64) + " " + units[i]
+}
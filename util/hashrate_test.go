@@ -0,0 +1,51 @@
+package util
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestHashrateMeter(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	m := NewHashrateMeterAt(start)
+
+	// 1000 H/s for two hours: one share of difficulty 1000 every second
+	now := start
+	for i := 0; i < 7200; i++ {
+		now = now.Add(time.Second)
+		m.AddAt(now, 1000)
+	}
+
+	for _, w := range HashrateWindows {
+		h := m.HashrateAt(now, w)
+		if math.Abs(h-1000)/1000 > 0.05 {
+			t.Errorf("hashrate over %s = %f; want ~1000", FormatWindow(w), h)
+		}
+	}
+
+	// no shares for 30 minutes
+	later := now.Add(30 * time.Minute)
+	if h := m.HashrateAt(later, 15*time.Minute); h != 0 {
+		t.Errorf("15m hashrate after 30 minutes without shares = %f; want 0", h)
+	}
+	if h := m.HashrateAt(later, time.Hour); math.Abs(h-500)/500 > 0.05 {
+		t.Errorf("1h hashrate after 30 minutes without shares = %f; want ~500", h)
+	}
+}
+
+func TestFormatHashrate(t *testing.T) {
+	tests := map[float64]string{
+		0:          "0.00 H/s",
+		999:        "999.00 H/s",
+		1500:       "1.50 KH/s",
+		2_500_000:  "2.50 MH/s",
+		3e12 + 1e9: "3.00 TH/s",
+	}
+
+	for input, expected := range tests {
+		if got := FormatHashrate(input); got != expected {
+			t.Errorf("FormatHashrate(%f) = %q; want %q", input, got, expected)
+		}
+	}
+}
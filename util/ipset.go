@@ -0,0 +1,49 @@
+package util
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// IPSet is a list of IP ranges
+type IPSet []netip.Prefix
+
+// parses a list of CIDR ranges (192.168.1.0/24, fd00::/8) or single IPs
+func ParseIPSet(list []string) (IPSet, error) {
+	set := make(IPSet, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IP or CIDR range %q", s)
+			}
+			set = append(set, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP or CIDR range %q", s)
+		}
+		set = append(set, prefix.Masked())
+	}
+	return set, nil
+}
+
+// returns true if the IP is in one of the ranges. Invalid IPs are never contained.
+func (s IPSet) Contains(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range s {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package util
+
+import "testing"
+
+func TestIPSet(t *testing.T) {
+	set, err := ParseIPSet([]string{"192.168.1.0/24", "10.0.0.5", "fd00::/8", " 172.16.5.9/16 ", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ip       string
+		expected bool
+	}{
+		{"192.168.1.1", true},
+		{"192.168.1.255", true},
+		{"192.168.2.1", false},
+		{"10.0.0.5", true},
+		{"10.0.0.6", false},
+		{"172.16.200.1", true},
+		{"::ffff:192.168.1.7", true},
+		{"fd12::1", true},
+		{"fe80::1", false},
+		{"::1", true},
+		{"::2", false},
+		{RemovePort("[::1]:37172"), true},
+		{RemovePort("[fd00::7]:37172"), true},
+		{RemovePort("[::ffff:10.0.0.5]:37172"), true},
+		{"not an ip", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		result := set.Contains(test.ip)
+		if result != test.expected {
+			t.Errorf("Contains(%q) = %v; want %v", test.ip, result, test.expected)
+		}
+	}
+}
+
+func TestParseIPSetInvalid(t *testing.T) {
+	for _, s := range []string{"192.168.1.0/33", "300.1.1.1", "example.com", ""} {
+		if _, err := ParseIPSet([]string{s}); err == nil {
+			t.Errorf("ParseIPSet(%q) succeeded; want an error", s)
+		}
+	}
+}
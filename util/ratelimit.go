@@ -0,0 +1,57 @@
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket: it allows bursts of burst events, refilled at rate events per second
+type RateLimiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	mu sync.Mutex
+}
+
+// returns a full rate limiter
+func NewRateLimiter(rate, burst float64) *RateLimiter {
+	return &RateLimiter{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+	}
+}
+
+// returns true if an event is allowed now, and consumes a token
+func (r *RateLimiter) Allow() bool {
+	return r.AllowAt(time.Now())
+}
+
+// returns true if an event is allowed at the given time, and consumes a token
+func (r *RateLimiter) AllowAt(t time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.last.IsZero() && t.After(r.last) {
+		r.tokens = min(r.burst, r.tokens+t.Sub(r.last).Seconds()*r.rate)
+	}
+	if r.last.IsZero() || t.After(r.last) {
+		r.last = t
+	}
+
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+	return true
+}
+
+// returns true if the bucket would be full at the given time, so the limiter can be forgotten
+func (r *RateLimiter) FullAt(t time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.tokens+t.Sub(r.last).Seconds()*r.rate >= r.burst
+}
@@ -0,0 +1,46 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	r := NewRateLimiter(2, 3)
+
+	// the burst is allowed at once
+	for i := 0; i < 3; i++ {
+		if !r.AllowAt(start) {
+			t.Fatalf("event %d of the burst refused", i)
+		}
+	}
+	if r.AllowAt(start) {
+		t.Error("event beyond the burst allowed")
+	}
+
+	// 2 events per second are refilled
+	if !r.AllowAt(start.Add(500 * time.Millisecond)) {
+		t.Error("refilled event refused")
+	}
+	if r.AllowAt(start.Add(500 * time.Millisecond)) {
+		t.Error("event beyond the refill allowed")
+	}
+
+	// the bucket never holds more than the burst
+	later := start.Add(time.Hour)
+	if !r.FullAt(later) {
+		t.Error("bucket not full after an hour")
+	}
+	for i := 0; i < 3; i++ {
+		if !r.AllowAt(later) {
+			t.Fatalf("event %d of the second burst refused", i)
+		}
+	}
+	if r.AllowAt(later) {
+		t.Error("event beyond the second burst allowed")
+	}
+	if r.FullAt(later) {
+		t.Error("bucket full right after the burst")
+	}
+}
@@ -0,0 +1,90 @@
+package util
+
+import (
+	"sort"
+	"sync"
+)
+
+// SampleWindow keeps the last samples of a measure, such as a latency, to compute its percentiles
+type SampleWindow struct {
+	samples []float64
+	next    int
+	full    bool
+
+	mu sync.Mutex
+}
+
+// NewSampleWindow returns a SampleWindow keeping the given number of samples
+func NewSampleWindow(size int) *SampleWindow {
+	return &SampleWindow{
+		samples: make([]float64, size),
+	}
+}
+
+func (w *SampleWindow) Add(v float64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.samples[w.next] = v
+	w.next++
+	if w.next == len(w.samples) {
+		w.next = 0
+		w.full = true
+	}
+}
+
+// Len returns the number of samples in the window
+func (w *SampleWindow) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.full {
+		return len(w.samples)
+	}
+	return w.next
+}
+
+// Percentiles returns the given percentiles (between 0 and 100) of the samples, or zeros if there are no samples
+func (w *SampleWindow) Percentiles(ps ...float64) []float64 {
+	w.mu.Lock()
+	n := w.next
+	if w.full {
+		n = len(w.samples)
+	}
+	sorted := make([]float64, n)
+	copy(sorted, w.samples[:n])
+	w.mu.Unlock()
+
+	sort.Float64s(sorted)
+
+	res := make([]float64, len(ps))
+	if n == 0 {
+		return res
+	}
+	for i, p := range ps {
+		// nearest rank
+		rank := int(p/100*float64(n)+0.5) - 1
+		res[i] = sorted[max(0, min(rank, n-1))]
+	}
+	return res
+}
+
+// Mean returns the mean of the samples, or 0 if there are no samples
+func (w *SampleWindow) Mean() float64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n := w.next
+	if w.full {
+		n = len(w.samples)
+	}
+	if n == 0 {
+		return 0
+	}
+
+	sum := 0.0
+	for _, v := range w.samples[:n] {
+		sum += v
+	}
+	return sum / float64(n)
+}
@@ -0,0 +1,38 @@
+package util
+
+import "testing"
+
+func TestSampleWindow(t *testing.T) {
+	w := NewSampleWindow(100)
+
+	if p := w.Percentiles(50); p[0] != 0 {
+		t.Errorf("median of an empty window = %f; want 0", p[0])
+	}
+
+	for i := 1; i <= 100; i++ {
+		w.Add(float64(i))
+	}
+
+	p := w.Percentiles(50, 90, 99, 100)
+	want := []float64{50, 90, 99, 100}
+	for i := range want {
+		if p[i] != want[i] {
+			t.Errorf("percentiles = %v; want %v", p, want)
+			break
+		}
+	}
+	if m := w.Mean(); m != 50.5 {
+		t.Errorf("mean = %f; want 50.5", m)
+	}
+
+	// the oldest samples are replaced
+	for i := 0; i < 50; i++ {
+		w.Add(1000)
+	}
+	if w.Len() != 100 {
+		t.Errorf("len = %d; want 100", w.Len())
+	}
+	if p := w.Percentiles(60); p[0] != 1000 {
+		t.Errorf("60th percentile after overwriting half of the samples = %f; want 1000", p[0])
+	}
+}
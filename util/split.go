@@ -0,0 +1,29 @@
+package util
+
+// returns the work missing to each target to receive its percentage of the total work, negative when it received
+// more than its percentage
+func SplitDeficits(percents, work []float64) []float64 {
+	total := 0.0
+	for _, w := range work {
+		total += w
+	}
+
+	deficits := make([]float64, len(percents))
+	for i, p := range percents {
+		deficits[i] = p/100*total - work[i]
+	}
+	return deficits
+}
+
+// returns true if moving the given amount of work from the target with deficit from to the target with deficit to
+// brings both closer to their percentage
+func SplitMoveImproves(from, to, amount float64) bool {
+	return abs(from+amount)+abs(to-amount) < abs(from)+abs(to)
+}
+
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
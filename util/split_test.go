@@ -0,0 +1,46 @@
+package util
+
+import "testing"
+
+func TestSplitDeficits(t *testing.T) {
+	tests := []struct {
+		percents, work, expected []float64
+	}{
+		{[]float64{70, 30}, []float64{0, 0}, []float64{0, 0}},
+		{[]float64{70, 30}, []float64{70, 30}, []float64{0, 0}},
+		{[]float64{70, 30}, []float64{50, 50}, []float64{20, -20}},
+		{[]float64{50, 25, 25}, []float64{0, 0, 100}, []float64{50, 25, -75}},
+	}
+
+	for _, test := range tests {
+		result := SplitDeficits(test.percents, test.work)
+		for i := range result {
+			if result[i] != test.expected[i] {
+				t.Errorf("SplitDeficits(%v, %v) = %v; want %v", test.percents, test.work, result, test.expected)
+				break
+			}
+		}
+	}
+}
+
+func TestSplitMoveImproves(t *testing.T) {
+	tests := []struct {
+		from, to, amount float64
+		expected         bool
+	}{
+		{-20, 20, 10, true},
+		{-20, 20, 20, true},
+		{-20, 20, 40, false},
+		{-5, 5, 20, false},
+		{10, 20, 5, false},
+		{-20, 20, 0, false},
+	}
+
+	for _, test := range tests {
+		result := SplitMoveImproves(test.from, test.to, test.amount)
+		if result != test.expected {
+			t.Errorf("SplitMoveImproves(%v, %v, %v) = %v; want %v", test.from, test.to, test.amount, result,
+				test.expected)
+		}
+	}
+}
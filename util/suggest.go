@@ -0,0 +1,35 @@
+package util
+
+// returns the Levenshtein distance between a and b: the number of inserted, deleted or substituted bytes
+func EditDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// returns the candidate closest to s, or an empty string if none is close enough to be a likely typo
+func Suggest(s string, candidates []string) string {
+	best := ""
+	bestDist := max(2, len(s)/2) + 1
+	for _, c := range candidates {
+		if d := EditDistance(s, c); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
@@ -0,0 +1,48 @@
+package util
+
+import "testing"
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"pool_url", "pool_url", 0},
+		{"pool_ulr", "pool_url", 2},
+		{"pool_urls", "pool_url", 1},
+		{"kitten", "sitting", 3},
+	}
+
+	for _, test := range tests {
+		result := EditDistance(test.a, test.b)
+		if result != test.expected {
+			t.Errorf("EditDistance(%q, %q) = %d; want %d", test.a, test.b, result, test.expected)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"pool_url", "pool_protocol", "wallet", "stratum_bind_port", "getwork_bind_port"}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"pool_ulr", "pool_url"},
+		{"walet", "wallet"},
+		{"stratum_port", "stratum_bind_port"},
+		{"getwork-bind-port", "getwork_bind_port"},
+		{"solo", ""},
+		{"x", ""},
+	}
+
+	for _, test := range tests {
+		result := Suggest(test.input, candidates)
+		if result != test.expected {
+			t.Errorf("Suggest(%q) = %q; want %q", test.input, result, test.expected)
+		}
+	}
+}
@@ -4,14 +4,24 @@ import (
 	"crypto/rand"
 	"encoding/binary"
 	"encoding/hex"
+	"net"
+	"net/netip"
 	"strconv"
 	"strings"
 	"time"
 	"xelis-mining-proxy/log"
 )
 
+// returns the IP of a host:port address, such as 127.0.0.1:8080 or [::1]:8080. IPv4-mapped IPv6 addresses are
+// returned as IPv4, and the zone of IPv6 addresses is removed.
 func RemovePort(s string) string {
-	return strings.Split(s, ":")[0]
+	if addr, err := netip.ParseAddrPort(s); err == nil {
+		return addr.Addr().Unmap().WithZone("").String()
+	}
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		return host
+	}
+	return s
 }
 
 func RandomUint64() uint64 {
@@ -22,3 +22,25 @@ func TestParseAlgorithm(t *testing.T) {
 		}
 	}
 }
+
+func TestRemovePort(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"127.0.0.1:8080", "127.0.0.1"},
+		{"[::1]:37172", "::1"},
+		{"[2001:db8::5]:443", "2001:db8::5"},
+		{"[::ffff:192.168.1.7]:80", "192.168.1.7"},
+		{"[fe80::1%eth0]:80", "fe80::1"},
+		{"localhost:80", "localhost"},
+		{"192.168.1.1", "192.168.1.1"},
+	}
+
+	for _, test := range tests {
+		result := RemovePort(test.input)
+		if result != test.expected {
+			t.Errorf("RemovePort(%q) = %q; want %q", test.input, result, test.expected)
+		}
+	}
+}
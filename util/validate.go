@@ -0,0 +1,60 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrWorkhashMismatch   = errors.New("work hash does not match the issued job")
+	ErrPublickeyMismatch  = errors.New("public key does not match the issued job")
+	ErrExtraNonceMismatch = errors.New("extra nonce does not belong to this connection")
+)
+
+// TimestampError is returned when a submitted timestamp is outside of the allowed window
+type TimestampError struct {
+	Timestamp uint64
+	Min       uint64
+	Max       uint64
+}
+
+func (e *TimestampError) Error() string {
+	return fmt.Sprintf("timestamp %d outside of allowed window [%d, %d]", e.Timestamp, e.Min, e.Max)
+}
+
+// ValidateSubmission checks a submitted BlockMiner against the BlockMiner that was issued to the miner.
+// Work hash, public key and extra nonce must be unchanged, and the timestamp must not be older than the
+// issued timestamp minus drift, nor newer than now plus drift. All the times are in milliseconds.
+func ValidateSubmission(submitted, issued BlockMiner, now, drift uint64) error {
+	if submitted.GetWorkhash() != issued.GetWorkhash() {
+		return ErrWorkhashMismatch
+	}
+	if submitted.GetPublickey() != issued.GetPublickey() {
+		return ErrPublickeyMismatch
+	}
+	if !ValidateExtraNonces(submitted.GetExtraNonce(), issued.GetExtraNonce()) {
+		return ErrExtraNonceMismatch
+	}
+
+	ts := submitted.GetTimestamp()
+	issuedTs := issued.GetTimestamp()
+
+	var min uint64
+	if issuedTs > drift {
+		min = issuedTs - drift
+	}
+	max := now + drift
+	if issuedTs > now {
+		max = issuedTs + drift
+	}
+
+	if ts < min || ts > max {
+		return &TimestampError{
+			Timestamp: ts,
+			Min:       min,
+			Max:       max,
+		}
+	}
+
+	return nil
+}
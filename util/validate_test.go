@@ -0,0 +1,46 @@
+package util
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateSubmission(t *testing.T) {
+	const now = 1715417118848
+	const drift = 10_000
+
+	issued := NewBlockMiner([32]byte{0x11}, [32]byte{0x22}, [32]byte{0x33})
+	issued.SetTimestamp(now - 5_000)
+
+	tests := []struct {
+		name   string
+		modify func(b *BlockMiner)
+		err    error
+	}{
+		{"valid", func(b *BlockMiner) { b.SetNonce(1234) }, nil},
+		{"newer timestamp", func(b *BlockMiner) { b.SetTimestamp(now + 1_000) }, nil},
+		{"workhash", func(b *BlockMiner) { b[0] ^= 0xff }, ErrWorkhashMismatch},
+		{"public key", func(b *BlockMiner) { b.SetPublickey([32]byte{0x44}) }, ErrPublickeyMismatch},
+		{"extra nonce", func(b *BlockMiner) { b.SetExtraNonce([32]byte{0x55}) }, ErrExtraNonceMismatch},
+		{"too old", func(b *BlockMiner) { b.SetTimestamp(now - 5_000 - drift - 1) }, &TimestampError{}},
+		{"too new", func(b *BlockMiner) { b.SetTimestamp(now + drift + 1) }, &TimestampError{}},
+	}
+
+	for _, test := range tests {
+		submitted := issued
+		test.modify(&submitted)
+
+		err := ValidateSubmission(submitted, issued, now, drift)
+
+		var tsErr *TimestampError
+		if _, ok := test.err.(*TimestampError); ok {
+			if !errors.As(err, &tsErr) {
+				t.Errorf("%s: expected timestamp error, got %v", test.name, err)
+			}
+			continue
+		}
+		if err != test.err {
+			t.Errorf("%s: expected %v, got %v", test.name, test.err, err)
+		}
+	}
+}
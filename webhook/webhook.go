@@ -0,0 +1,186 @@
+// Package webhook posts JSON event notifications to HTTP endpoints, with optional HMAC signatures, retries and
+// debouncing.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+	"xelis-mining-proxy/log"
+)
+
+var webhookLog = log.Component("webhook")
+
+// name of the header containing the HMAC-SHA256 signature of the body
+const SIGNATURE_HEADER = "X-Signature-256"
+
+// name of the header containing the event name
+const EVENT_HEADER = "X-Event"
+
+// Endpoint is a URL notified of the events it subscribed to
+type Endpoint struct {
+	Url    string   `json:"url" desc:"URL the events are posted to"`
+	Secret string   `json:"secret" desc:"Key of the HMAC-SHA256 signature of the body, empty to not sign"`
+	Events []string `json:"events" desc:"Events sent to this endpoint"`
+}
+
+// Event is the JSON body posted to the endpoints
+type Event struct {
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+	// number of notifications of the same event dropped by debouncing since the previous one
+	Suppressed uint64         `json:"suppressed,omitempty"`
+	Data       map[string]any `json:"data,omitempty"`
+}
+
+// Notifier sends events to the endpoints that subscribed to them
+type Notifier struct {
+	endpoints  []Endpoint
+	debounce   time.Duration
+	retries    int
+	retryDelay time.Duration
+	client     *http.Client
+
+	mu         sync.Mutex
+	last       map[string]time.Time
+	suppressed map[string]uint64
+
+	wg sync.WaitGroup
+}
+
+// New returns a notifier that sends the same event at most once per debounce interval, and retries failed
+// deliveries the given number of times
+func New(endpoints []Endpoint, debounce time.Duration, retries int) *Notifier {
+	return &Notifier{
+		endpoints:  endpoints,
+		debounce:   debounce,
+		retries:    retries,
+		retryDelay: time.Second,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		last:       make(map[string]time.Time),
+		suppressed: make(map[string]uint64),
+	}
+}
+
+// SetRetryDelay sets the delay before the first retry, doubled after every failed attempt
+func (n *Notifier) SetRetryDelay(d time.Duration) {
+	n.retryDelay = d
+}
+
+// Subscribed returns true if an endpoint subscribed to the event
+func (n *Notifier) Subscribed(event string) bool {
+	for _, e := range n.endpoints {
+		if slices.Contains(e.Events, event) {
+			return true
+		}
+	}
+	return false
+}
+
+// Notify sends the event to the endpoints that subscribed to it. The key identifies the subject of the event
+// (for example a worker name), notifications with the same event and key are debounced. It returns false if the
+// event wasn't sent.
+func (n *Notifier) Notify(event, key string, data map[string]any) bool {
+	if !n.Subscribed(event) {
+		return false
+	}
+
+	id := event + "/" + key
+	now := time.Now()
+
+	n.mu.Lock()
+	if last, ok := n.last[id]; ok && now.Sub(last) < n.debounce {
+		n.suppressed[id]++
+		n.mu.Unlock()
+		webhookLog.Debugf("debounced event %s %s", event, key)
+		return false
+	}
+	n.last[id] = now
+	suppressed := n.suppressed[id]
+	delete(n.suppressed, id)
+	n.mu.Unlock()
+
+	body, err := json.Marshal(Event{
+		Event:      event,
+		Time:       now,
+		Suppressed: suppressed,
+		Data:       data,
+	})
+	if err != nil {
+		webhookLog.Err("failed to encode event:", err)
+		return false
+	}
+
+	for _, e := range n.endpoints {
+		if slices.Contains(e.Events, event) {
+			n.wg.Add(1)
+			go n.deliver(e, event, body)
+		}
+	}
+	return true
+}
+
+// Wait waits for the pending deliveries
+func (n *Notifier) Wait() {
+	n.wg.Wait()
+}
+
+func (n *Notifier) deliver(e Endpoint, event string, body []byte) {
+	defer n.wg.Done()
+
+	delay := n.retryDelay
+	for attempt := 0; ; attempt++ {
+		err := n.post(e, event, body)
+		if err == nil {
+			webhookLog.Debugf("sent event %s to %s", event, e.Url)
+			return
+		}
+		if attempt >= n.retries {
+			webhookLog.Warnf("failed to send event %s to %s: %v", event, e.Url, err)
+			return
+		}
+
+		webhookLog.Debugf("failed to send event %s to %s, retrying in %v: %v", event, e.Url, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (n *Notifier) post(e Endpoint, event string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, e.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "xelis-mining-proxy")
+	req.Header.Set(EVENT_HEADER, event)
+	if e.Secret != "" {
+		req.Header.Set(SIGNATURE_HEADER, Sign(e.Secret, body))
+	}
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("status %s", res.Status)
+	}
+	return nil
+}
+
+// Sign returns the signature of the body sent in the signature header: "sha256=" followed by the hex encoded
+// HMAC-SHA256 of the body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
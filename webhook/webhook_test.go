@@ -0,0 +1,125 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type receiver struct {
+	mu       sync.Mutex
+	events   []Event
+	failures int // number of requests to fail before succeeding
+	secret   string
+	t        *testing.T
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	body, _ := io.ReadAll(req.Body)
+	if r.secret != "" && req.Header.Get(SIGNATURE_HEADER) != Sign(r.secret, body) {
+		r.t.Errorf("invalid signature %q", req.Header.Get(SIGNATURE_HEADER))
+	}
+
+	var e Event
+	if err := json.Unmarshal(body, &e); err != nil {
+		r.t.Error(err)
+	}
+	if req.Header.Get(EVENT_HEADER) != e.Event {
+		r.t.Errorf("event header %q, body event %q", req.Header.Get(EVENT_HEADER), e.Event)
+	}
+	r.events = append(r.events, e)
+}
+
+func (r *receiver) received() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Event(nil), r.events...)
+}
+
+func TestNotify(t *testing.T) {
+	r := &receiver{secret: "secret", t: t}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	n := New([]Endpoint{{Url: srv.URL, Secret: "secret", Events: []string{"miner_offline"}}}, time.Hour, 0)
+
+	if n.Notify("upstream_disconnected", "", nil) {
+		t.Error("sent an event without subscribers")
+	}
+	if !n.Notify("miner_offline", "rig1", map[string]any{"worker": "rig1"}) {
+		t.Error("event not sent")
+	}
+	n.Wait()
+
+	events := r.received()
+	if len(events) != 1 || events[0].Event != "miner_offline" || events[0].Data["worker"] != "rig1" {
+		t.Fatalf("unexpected events %+v", events)
+	}
+}
+
+func TestDebounce(t *testing.T) {
+	r := &receiver{t: t}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	n := New([]Endpoint{{Url: srv.URL, Events: []string{"miner_offline"}}}, 50*time.Millisecond, 0)
+
+	n.Notify("miner_offline", "rig1", nil)
+	if n.Notify("miner_offline", "rig1", nil) {
+		t.Error("event not debounced")
+	}
+	if !n.Notify("miner_offline", "rig2", nil) {
+		t.Error("events with another key must not be debounced")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if !n.Notify("miner_offline", "rig1", nil) {
+		t.Error("event still debounced after the interval")
+	}
+	n.Wait()
+
+	events := r.received()
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+	if events[2].Suppressed != 1 {
+		t.Errorf("expected 1 suppressed event, got %d", events[2].Suppressed)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	r := &receiver{failures: 2, t: t}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	n := New([]Endpoint{{Url: srv.URL, Events: []string{"block_found"}}}, 0, 2)
+	n.SetRetryDelay(time.Millisecond)
+
+	n.Notify("block_found", "", nil)
+	n.Wait()
+
+	if len(r.received()) != 1 {
+		t.Fatal("event not delivered after retries")
+	}
+
+	r.failures = 3
+	n.Notify("block_found", "", nil)
+	n.Wait()
+
+	if len(r.received()) != 1 {
+		t.Fatal("event delivered after exceeding the retries")
+	}
+}